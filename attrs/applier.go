@@ -0,0 +1,114 @@
+package attrs
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Applier changes ownership and mode of a single path. If info is a symbolic
+// link, the link itself is changed, not its target.
+type Applier interface {
+	Apply(path string, info os.FileInfo, a Attr) error
+}
+
+// NativeApplier uses chown(2)/chmod(2) directly, no process is spawned.
+type NativeApplier struct{}
+
+func (n *NativeApplier) Apply(path string, info os.FileInfo, a Attr) error {
+	uid, gid, err := a.ids()
+	if err != nil {
+		return err
+	}
+
+	if uid != -1 || gid != -1 {
+		err = os.Lchown(path, uid, gid)
+		if err != nil {
+			return err
+		}
+	}
+
+	// symbolic links have no mode of their own
+	if a.Perm != "" && !isSymlink(info) {
+		mode, err := ParseMode(a.Perm)
+		if err != nil {
+			return err
+		}
+		err = os.Chmod(path, mode.Apply(info.Mode(), info.IsDir()))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ExecApplier forks chown and chmod binaries for every path.
+type ExecApplier struct {
+	ChownPath, ChmodPath string
+}
+
+// NewExecApplier looks up chown and chmod binaries in PATH.
+func NewExecApplier(chownBin, chmodBin string) (*ExecApplier, error) {
+	chownPath, err := exec.LookPath(chownBin)
+	if err != nil {
+		return nil, err
+	}
+	chmodPath, err := exec.LookPath(chmodBin)
+	if err != nil {
+		return nil, err
+	}
+	return &ExecApplier{ChownPath: chownPath, ChmodPath: chmodPath}, nil
+}
+
+func (e *ExecApplier) Apply(path string, info os.FileInfo, a Attr) error {
+	if owner := a.owner(); owner != "" {
+		err := execCommand(e.ChownPath, "-h", owner, path)
+		if err != nil {
+			return err
+		}
+	}
+	if a.Perm != "" && !isSymlink(info) {
+		mode, err := a.chmodMode(info)
+		if err != nil {
+			return err
+		}
+		err = execCommand(e.ChmodPath, mode, path)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// chmodMode returns the resulting mode as an octal chmod argument, so the
+// binary neither applies its umask to symbolic modes nor keeps the
+// setuid and setgid bits of directories, as the extra leading zero asks.
+func (a Attr) chmodMode(info os.FileInfo) (string, error) {
+	m, err := ParseMode(a.Perm)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%05o", UnixPerm(m.Apply(info.Mode(), info.IsDir()))), nil
+}
+
+func execCommand(binPath string, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command(binPath, args...)
+	cmd.Stderr = &stderr
+	err := cmd.Start()
+	if err != nil {
+		return err
+	}
+	err = cmd.Wait()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%s: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package attrs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// Options tweak how a Spec is applied.
+type Options struct {
+	// Applier changes attributes of every matched path, defaults to
+	// NativeApplier.
+	Applier Applier
+
+	// KeepGoing records per path errors and continues with the rest instead
+	// of stopping at the first one.
+	KeepGoing bool
+
+	// Symlinks is the policy for rules not setting their own, defaults to
+	// SymlinksFollow.
+	Symlinks string
+
+	// IDs resolves user and group names, defaults to /etc/passwd and
+	// /etc/group below Root.
+	IDs *IDs
+
+	// Root prefixes every rule path, symbolic links are resolved without
+	// ever leaving it.
+	Root string
+
+	// Jobs is the number of paths applied concurrently, while walking goes
+	// on, the Applier must then be safe for concurrent use. Lower than two
+	// applies them one at a time.
+	Jobs int
+
+	// Summary, if set, receives the number of changed and already correct
+	// paths, even if Apply fails.
+	Summary *Summary
+
+	// Atomic restores every path already changed as soon as an error
+	// happens or the context is canceled, it can't be combined with
+	// KeepGoing.
+	Atomic bool
+}
+
+// Failure is an error that happened while processing a single path.
+type Failure struct {
+	Path string
+	Err  error
+}
+
+// Failures is returned by Apply, in KeepGoing mode, if any path failed.
+type Failures []Failure
+
+func (f Failures) Error() string {
+	if len(f) == 1 {
+		return fmt.Sprintf("%s: %s", f[0].Path, f[0].Err)
+	}
+	return fmt.Sprintf("%d paths failed", len(f))
+}
+
+// Apply walks every path matched by the spec and hands it over to the
+// applier, unless its ownership and mode are already right. It stops at the
+// first error unless KeepGoing is set.
+//
+// Rules are processed in declaration order, nested ones after their parent.
+// A path covered by several rules is only handled once, by the most specific
+// one (see owner).
+func Apply(ctx context.Context, spec *Spec, opts Options) error {
+	if !opts.Atomic {
+		return apply(ctx, spec, opts)
+	}
+	if opts.KeepGoing {
+		return fmt.Errorf("atomic mode can't keep going on errors")
+	}
+
+	ap := opts.Applier
+	if ap == nil {
+		ap = &NativeApplier{}
+	}
+	rec := &recorder{Applier: ap}
+	opts.Applier = rec
+	err := apply(ctx, spec, opts)
+	if err != nil {
+		// restore as much as possible, even if canceled
+		rerr := rollback(context.Background(), rec.records, ap, true)
+		if rerr != nil {
+			return fmt.Errorf("%s, unable to restore previous attributes: %s", err, rerr)
+		}
+	}
+	return err
+}
+
+func apply(ctx context.Context, spec *Spec, opts Options) error {
+	ap := opts.Applier
+	if ap == nil {
+		ap = &NativeApplier{}
+	}
+	err := validSymlinks(opts.Symlinks)
+	if err != nil {
+		return err
+	}
+
+	// unknown names fail before anything is changed
+	ids := opts.IDs
+	if ids == nil {
+		ids = hostIDs
+		if opts.Root != "" {
+			ids = NewIDs(opts.Root)
+		}
+	}
+	err = spec.Resolve(ids)
+	if err != nil {
+		return err
+	}
+
+	fs := rootFS{root: opts.Root}
+	if opts.Root != "" {
+		spec, err = spec.rooted()
+		if err != nil {
+			return err
+		}
+	}
+
+	pl := newPool(ctx, ap, opts.Jobs, opts.KeepGoing)
+	err = pl.wait(walkSpec(ctx, spec, fs, opts.Symlinks, pl))
+	if opts.Summary != nil {
+		*opts.Summary = pl.summary
+	}
+	return err
+}
+
+// walkSpec hands every path matched by the spec over to the pool.
+func walkSpec(ctx context.Context, spec *Spec, fs rootFS, symlinks string, pl *pool) error {
+	fail := pl.fail
+	rules := spec.rules()
+	for _, r := range rules {
+		if r.container() {
+			continue
+		}
+		r := r
+		policy := r.Symlinks
+		if policy == "" {
+			policy = symlinks
+		}
+		apply := func(path, hostPath string, info os.FileInfo) error {
+			if owner(rules, path) != r {
+				return nil
+			}
+			target, tinfo, err := fs.resolveSymlink(path, hostPath, info, policy)
+			if err != nil {
+				return fail(hostPath, err)
+			}
+			if tinfo == nil {
+				return nil
+			}
+			if target != hostPath {
+				// a followed target belongs to the rule owning it, if
+				// none, only links named by the rule itself are followed
+				tr := owner(rules, fs.logical(target, path))
+				if tr != r && (tr != nil || r.Recursive) {
+					return nil
+				}
+			}
+			return pl.apply(target, tinfo, r.attr(tinfo.IsDir()))
+		}
+
+		var files []string
+		if isGlob(r.Path) {
+			matches, err := fs.glob(r.Path, !r.SkipDotfiles)
+			if err != nil {
+				return err
+			}
+			files = matches
+		} else {
+			files = append(files, r.Path)
+		}
+
+		if !r.Recursive {
+			for _, f := range files {
+				err := ctx.Err()
+				if err != nil {
+					return err
+				}
+				if r.excluded(path.Dir(f), f) {
+					continue
+				}
+				hf, info, err := fs.lstat(f)
+				if err != nil {
+					err = fail(f, fmt.Errorf("no such file or directory: %s", f))
+					if err != nil {
+						return err
+					}
+					continue
+				}
+				err = apply(f, hf, info)
+				if err != nil {
+					return err
+				}
+			}
+		} else {
+			for _, f := range outermost(files) {
+				// the walk doesn't descend into links, resolve the root one
+				root := f
+				hostRoot, err := fs.host(f, policy != SymlinksSkip && policy != SymlinksLink)
+				if err != nil {
+					err = fail(f, err)
+					if err != nil {
+						return err
+					}
+					continue
+				}
+				walk := func(hostPath string, info os.FileInfo, err error) error {
+					if ctxErr := ctx.Err(); ctxErr != nil {
+						return ctxErr
+					}
+					rel, relErr := filepath.Rel(hostRoot, hostPath)
+					if relErr != nil {
+						return fail(hostPath, relErr)
+					}
+					p := path.Join(root, rel)
+					if r.excluded(root, p) {
+						if info != nil && info.IsDir() {
+							return filepath.SkipDir
+						}
+						return nil
+					}
+					if err != nil {
+						// unreadable directories are skipped on success
+						return fail(hostPath, err)
+					}
+					return apply(p, hostPath, info)
+				}
+				err = filepath.Walk(hostRoot, walk)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// outermost drops the paths below another one of the list, as walking the
+// latter already goes through them.
+func outermost(files []string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, f := range files {
+		below := false
+		for p := path.Dir(f); !below; p = path.Dir(p) {
+			below = seen[p]
+			if p == "/" || p == "." {
+				break
+			}
+		}
+		if below || seen[f] {
+			continue
+		}
+		seen[f] = true
+		out = append(out, f)
+	}
+	return out
+}
@@ -0,0 +1,158 @@
+// Package attrs parses fix-attrs configurations and applies the ownership
+// and permissions they describe.
+package attrs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Spec is a parsed configuration file, rules keep their declaration order
+// and nesting.
+type Spec struct {
+	Rules []Rule
+
+	// Warnings about entries that were skipped while parsing.
+	Warnings []string
+}
+
+// Rule describes which attributes are applied to a path.
+type Rule struct {
+	// Path is the absolute (or relative to the working directory) path, it
+	// may contain glob patterns: *, ?, [...], ** and {a,b}.
+	Path string
+
+	// Recursive applies attributes to every file below Path.
+	Recursive bool
+
+	// Exclude lists glob patterns, relative to Path, of files and
+	// directories to skip.
+	Exclude []string
+
+	// Symlinks is the policy for symbolic links, SymlinksSkip, SymlinksLink
+	// or SymlinksFollow, empty uses the global one.
+	Symlinks string
+
+	// SkipDotfiles stops wildcards in Path from matching names starting
+	// with a dot.
+	SkipDotfiles bool
+
+	// Dir is applied to directories, File to everything else.
+	Dir  Attr
+	File Attr
+
+	// Container entries only group nested rules, they have no attributes
+	// and don't match any path themselves.
+	Container bool
+
+	// Source locates the rule within its configuration, for reporting.
+	Source string
+
+	// Files are the nested rules, their Path is already joined with the
+	// parent one.
+	Files []Rule
+}
+
+// Attr is the desired ownership and permission, uid:gid:perm. Empty
+// components are left unchanged.
+type Attr struct {
+	Uid  string
+	Gid  string
+	Perm string
+
+	// loginGroup uses the login group of Uid, as in "chown user:".
+	loginGroup bool
+
+	// fallback is the numeric uid:gid used if Uid or Gid are not found.
+	fallback string
+
+	// numeric ids, set by Spec.Resolve
+	uid, gid int
+	resolved bool
+}
+
+// ParseAttr parses an uid:gid:perm string, perm being an octal or symbolic
+// mode. Empty or "-" components are left unchanged, e.g. "-:www-data:-".
+func ParseAttr(s string) (Attr, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return Attr{}, fmt.Errorf("unable to parse attributes: %s", s)
+	}
+	for i := range parts {
+		parts[i] = undash(parts[i])
+	}
+	if parts[2] != "" {
+		_, err := ParseMode(parts[2])
+		if err != nil {
+			return Attr{}, err
+		}
+	}
+
+	return Attr{Uid: parts[0], Gid: parts[1], Perm: parts[2]}, nil
+}
+
+func (a Attr) String() string {
+	gid := dash(a.Gid)
+	if a.loginGroup {
+		gid = ""
+	}
+	return dash(a.Uid) + ":" + gid + ":" + dash(a.Perm)
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// owner returns the owner argument as accepted by chown, empty if ownership
+// is left unchanged. Resolved attributes use numeric ids.
+func (a Attr) owner() string {
+	if a.resolved {
+		var owner string
+		if a.uid != -1 {
+			owner = strconv.Itoa(a.uid)
+		}
+		if a.gid != -1 {
+			owner += ":" + strconv.Itoa(a.gid)
+		}
+		return owner
+	}
+	switch {
+	case a.loginGroup:
+		return a.Uid + ":"
+	case a.Gid == "":
+		return a.Uid
+	}
+	return a.Uid + ":" + a.Gid
+}
+
+// rules returns every rule, nested ones included, in declaration order with
+// parents before their children.
+func (s *Spec) rules() []*Rule {
+	var rules []*Rule
+	var visit func(rs []Rule)
+	visit = func(rs []Rule) {
+		for i := range rs {
+			rules = append(rules, &rs[i])
+			visit(rs[i].Files)
+		}
+	}
+	visit(s.Rules)
+	return rules
+}
+
+// container reports whether the rule only groups nested rules.
+func (r *Rule) container() bool {
+	return r.Container
+}
+
+// attr returns the attributes that apply to a directory or a file.
+func (r *Rule) attr(isDir bool) Attr {
+	if isDir {
+		return r.Dir
+	}
+	return r.File
+}
@@ -0,0 +1,173 @@
+package attrs
+
+import (
+	"os"
+	"sync"
+)
+
+// execArgMax is the room, in bytes, for arguments and environment of a
+// single invocation. Conservative, as ARG_MAX is at least 128KiB on Linux.
+const execArgMax = 128 * 1024
+
+// Flusher is implemented by appliers deferring changes, Flush applies them
+// and returns Failures for the paths that failed.
+type Flusher interface {
+	Flush() error
+}
+
+// flush flushes ap if it defers changes.
+func flush(ap Applier) error {
+	if f, ok := ap.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// BatchExecApplier is an ExecApplier that, instead of forking chown and
+// chmod for every path, groups paths sharing the same owner or mode and
+// changes them with as few invocations as the argument size limit allows,
+// on Flush. If an invocation fails, its paths are retried in halves to
+// find out which ones failed. As nothing changes until Flush, failures are
+// only known once every path was handed over.
+type BatchExecApplier struct {
+	ExecApplier
+
+	mu      sync.Mutex
+	chown   batches
+	chmod   batches
+	pending map[string]bool
+	failed  Failures
+}
+
+// NewBatchExecApplier looks up chown and chmod binaries in PATH.
+func NewBatchExecApplier(chownBin, chmodBin string) (*BatchExecApplier, error) {
+	e, err := NewExecApplier(chownBin, chmodBin)
+	if err != nil {
+		return nil, err
+	}
+	return &BatchExecApplier{ExecApplier: *e}, nil
+}
+
+// Apply queues the path, changing the same path twice flushes what is
+// queued first so changes keep their order.
+func (b *BatchExecApplier) Apply(path string, info os.FileInfo, a Attr) error {
+	var mode string
+	if a.Perm != "" && !isSymlink(info) {
+		var err error
+		mode, err = a.chmodMode(info)
+		if err != nil {
+			return err
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.pending[path] {
+		b.flush()
+	}
+	if b.pending == nil {
+		b.pending = make(map[string]bool)
+	}
+	b.pending[path] = true
+
+	if owner := a.owner(); owner != "" {
+		b.chown.add(owner, path)
+	}
+	if mode != "" {
+		b.chmod.add(mode, path)
+	}
+	return nil
+}
+
+func (b *BatchExecApplier) Flush() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.flush()
+	failed := b.failed
+	b.failed = nil
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
+}
+
+// flush runs every queued batch, ownership first as chown may clear
+// setuid and setgid bits.
+func (b *BatchExecApplier) flush() {
+	b.chown.run(b.ChownPath, []string{"-h"}, &b.failed)
+	b.chmod.run(b.ChmodPath, nil, &b.failed)
+	b.pending = nil
+}
+
+// batches are paths grouped by the argument they share, in the order that
+// argument was first seen.
+type batches struct {
+	keys  []string
+	paths map[string][]string
+}
+
+func (bs *batches) add(key, path string) {
+	if bs.paths == nil {
+		bs.paths = make(map[string][]string)
+	}
+	if _, ok := bs.paths[key]; !ok {
+		bs.keys = append(bs.keys, key)
+	}
+	bs.paths[key] = append(bs.paths[key], path)
+}
+
+// run invokes bin with args, key and as many paths as fit, for every key.
+// Failures are appended to failed.
+func (bs *batches) run(bin string, args []string, failed *Failures) {
+	for _, key := range bs.keys {
+		fixed := append(append([]string{}, args...), key)
+		for _, chunk := range chunkArgs(bs.paths[key], argSize(append(fixed, bin))) {
+			bisect(bin, fixed, chunk, failed)
+		}
+	}
+	*bs = batches{}
+}
+
+// bisect invokes bin on paths, splitting them in halves on failure until
+// the failing ones are found.
+func bisect(bin string, fixed, paths []string, failed *Failures) {
+	err := execCommand(bin, append(fixed[:len(fixed):len(fixed)], paths...)...)
+	switch {
+	case err == nil:
+	case len(paths) == 1:
+		*failed = append(*failed, Failure{Path: paths[0], Err: err})
+	default:
+		bisect(bin, fixed, paths[:len(paths)/2], failed)
+		bisect(bin, fixed, paths[len(paths)/2:], failed)
+	}
+}
+
+// chunkArgs splits paths so that, along with used bytes of other arguments
+// and the environment, every chunk fits into execArgMax.
+func chunkArgs(paths []string, used int) [][]string {
+	used += argSize(os.Environ())
+	var chunks [][]string
+	start, size := 0, used
+	for i, p := range paths {
+		n := argSize([]string{p})
+		if i > start && size+n > execArgMax {
+			chunks = append(chunks, paths[start:i])
+			start, size = i, used
+		}
+		size += n
+	}
+	if start < len(paths) {
+		chunks = append(chunks, paths[start:])
+	}
+	return chunks
+}
+
+// argSize is the room taken by args: the strings, their terminating NUL
+// and their pointer.
+func argSize(args []string) int {
+	n := 0
+	for _, a := range args {
+		n += len(a) + 1 + 8
+	}
+	return n
+}
@@ -0,0 +1,68 @@
+package attrs
+
+import (
+	"fmt"
+)
+
+// Conflict describes two rules targeting the same paths.
+type Conflict struct {
+	// Rule is declared after Other.
+	Rule, Other *Rule
+
+	// Duplicate is set if both rules share exactly the same path, otherwise
+	// one of them covers the other with different attributes.
+	Duplicate bool
+}
+
+func (c Conflict) String() string {
+	if c.Duplicate {
+		return fmt.Sprintf("duplicate path %s: declared at %s and %s",
+			c.Rule.Path, c.Other.Source, c.Rule.Source)
+	}
+	a, b := c.Other, c.Rule
+	if !covers(a, b) {
+		a, b = b, a
+	}
+	return fmt.Sprintf("%s (%s) overlaps %s (%s) with different attributes",
+		a.Path, a.Source, b.Path, b.Source)
+}
+
+// Conflicts finds duplicated paths and rules whose glob or recursive path
+// covers another rule with different attributes.
+func (s *Spec) Conflicts() []Conflict {
+	var conflicts []Conflict
+	rules := s.rules()
+	for i, r := range rules {
+		if r.container() {
+			continue
+		}
+		for _, o := range rules[:i] {
+			if o.container() {
+				continue
+			}
+			if o.Path == r.Path && o.Recursive == r.Recursive {
+				conflicts = append(conflicts, Conflict{Rule: r, Other: o, Duplicate: true})
+				continue
+			}
+			if o.Dir == r.Dir && o.File == r.File {
+				continue
+			}
+			if covers(o, r) || covers(r, o) {
+				conflicts = append(conflicts, Conflict{Rule: r, Other: o})
+			}
+		}
+	}
+	return conflicts
+}
+
+// covers reports whether a glob or recursive rule a reaches the paths of b.
+func covers(a, b *Rule) bool {
+	if !a.Recursive && !isGlob(a.Path) {
+		return false
+	}
+	if !a.Recursive && isGlob(b.Path) {
+		// two patterns, undecidable without the filesystem
+		return false
+	}
+	return a.match(b.Path).kind != matchNone
+}
@@ -0,0 +1,58 @@
+package attrs
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+const permMask = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+// Diff compares current ownership and mode of a file against the desired
+// attributes and returns a human readable description of each difference.
+func Diff(info os.FileInfo, a Attr) ([]string, error) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil, fmt.Errorf("unable to stat: %s", info.Name())
+	}
+
+	uid, gid, err := a.ids()
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []string
+	if uid != -1 && int(st.Uid) != uid {
+		changes = append(changes, fmt.Sprintf("uid %d -> %d", st.Uid, uid))
+	}
+	if gid != -1 && int(st.Gid) != gid {
+		changes = append(changes, fmt.Sprintf("gid %d -> %d", st.Gid, gid))
+	}
+	if a.Perm != "" && !isSymlink(info) {
+		m, err := ParseMode(a.Perm)
+		if err != nil {
+			return nil, err
+		}
+		mode := m.Apply(info.Mode(), info.IsDir())
+		if info.Mode()&permMask != mode {
+			changes = append(changes, fmt.Sprintf("mode %04o -> %04o",
+				UnixPerm(info.Mode()), UnixPerm(mode)))
+		}
+	}
+	return changes, nil
+}
+
+// UnixPerm converts an os.FileMode back into octal permission bits.
+func UnixPerm(mode os.FileMode) uint32 {
+	perm := uint32(mode & os.ModePerm)
+	if mode&os.ModeSetuid != 0 {
+		perm |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		perm |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		perm |= 01000
+	}
+	return perm
+}
@@ -0,0 +1,159 @@
+package attrs
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+// ExportOptions tweak how a directory tree is exported.
+type ExportOptions struct {
+	// Path is where the tree lives in the exported spec, defaults to the
+	// absolute path of the directory.
+	Path string
+
+	// Names uses user and group names, resolved with IDs, instead of
+	// numeric ids. Unknown ids are kept numeric.
+	Names bool
+
+	// IDs resolves user and group ids into names, defaults to /etc/passwd
+	// and /etc/group.
+	IDs *IDs
+}
+
+// Export walks a directory tree and returns a spec reproducing its current
+// ownership and permissions. Subtrees sharing the same directory and file
+// attributes are collapsed into recursive rules, the rest are nested rules.
+// Symbolic links are not exported, recursive rules containing them skip
+// them. Names with glob characters are escaped.
+func Export(dir string, opts ExportOptions) (*Spec, error) {
+	p := opts.Path
+	if p == "" {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+		p = abs
+	}
+	ids := opts.IDs
+	if ids == nil {
+		ids = hostIDs
+	}
+
+	x := &exporter{ids: ids, names: opts.Names}
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if isSymlink(info) {
+		return nil, fmt.Errorf("unable to export a symbolic link: %s", dir)
+	}
+	r, _, err := x.export(dir, path.Clean(p), info)
+	if err != nil {
+		return nil, err
+	}
+	return &Spec{Rules: []Rule{r}}, nil
+}
+
+type exporter struct {
+	ids   *IDs
+	names bool
+}
+
+// subtree summarizes the attributes found below a directory, itself
+// included.
+type subtree struct {
+	uniform  bool
+	dir      Attr
+	file     Attr
+	files    bool
+	symlinks bool
+}
+
+func (x *exporter) export(hostPath, p string, info os.FileInfo) (Rule, subtree, error) {
+	a, err := x.attr(info)
+	if err != nil {
+		return Rule{}, subtree{}, fmt.Errorf("%s: %s", hostPath, err)
+	}
+	if !info.IsDir() {
+		return Rule{Path: escapeGlob(p), Dir: a, File: a}, subtree{uniform: true, file: a, files: true}, nil
+	}
+
+	names, err := readDirNames(hostPath)
+	if err != nil {
+		return Rule{}, subtree{}, err
+	}
+	st := subtree{uniform: true, dir: a}
+	var children []Rule
+	for _, name := range names {
+		hp := filepath.Join(hostPath, name)
+		ci, err := os.Lstat(hp)
+		if err != nil {
+			return Rule{}, subtree{}, err
+		}
+		if isSymlink(ci) {
+			st.symlinks = true
+			continue
+		}
+
+		child, cst, err := x.export(hp, path.Join(p, name), ci)
+		if err != nil {
+			return Rule{}, subtree{}, err
+		}
+		children = append(children, child)
+
+		st.symlinks = st.symlinks || cst.symlinks
+		if !cst.uniform || ci.IsDir() && cst.dir != a {
+			st.uniform = false
+		}
+		if cst.files {
+			if st.files && cst.file != st.file {
+				st.uniform = false
+			}
+			st.file = cst.file
+			st.files = true
+		}
+	}
+
+	r := Rule{Path: escapeGlob(p), Dir: a, File: a}
+	switch {
+	case len(children) == 0:
+	case st.uniform:
+		r.Recursive = true
+		if st.files {
+			r.File = st.file
+		}
+		if st.symlinks {
+			r.Symlinks = SymlinksSkip
+		}
+	default:
+		r.Files = children
+	}
+	return r, st, nil
+}
+
+// attr returns the current attributes of a file.
+func (x *exporter) attr(info os.FileInfo) (Attr, error) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return Attr{}, fmt.Errorf("unable to stat: %s", info.Name())
+	}
+	uid := strconv.Itoa(int(st.Uid))
+	gid := strconv.Itoa(int(st.Gid))
+	if x.names {
+		if name := x.ids.UserName(int(st.Uid)); name != "" {
+			uid = name
+		}
+		if name := x.ids.GroupName(int(st.Gid)); name != "" {
+			gid = name
+		}
+	}
+	return Attr{
+		Uid:  uid,
+		Gid:  gid,
+		Perm: fmt.Sprintf("%04o", UnixPerm(info.Mode())),
+	}, nil
+}
@@ -0,0 +1,260 @@
+package attrs
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Patterns support filepath.Match syntax (*, ?, [...]) per path segment,
+// ** matching zero or more segments and {a,b} alternatives. Unless dot is
+// set, wildcards don't match names starting with a dot.
+
+func isGlob(p string) bool {
+	return strings.ContainsAny(p, "*?[{")
+}
+
+func hasMeta(segment string) bool {
+	return strings.ContainsAny(segment, "*?[\\")
+}
+
+// escapeGlob escapes the pattern characters of a literal path, backslashes
+// included, as they only escape within patterns.
+func escapeGlob(p string) string {
+	if !isGlob(p) {
+		return p
+	}
+	b := make([]byte, 0, len(p))
+	for i := 0; i < len(p); i++ {
+		if strings.IndexByte("*?[{\\", p[i]) >= 0 {
+			b = append(b, '\\')
+		}
+		b = append(b, p[i])
+	}
+	return string(b)
+}
+
+// expandBraces expands {a,b} alternatives, nested ones included. Braces
+// without a comma are kept literally.
+func expandBraces(p string) []string {
+	open, depth := -1, 0
+	for i := 0; i < len(p); i++ {
+		switch p[i] {
+		case '\\':
+			i++
+		case '{':
+			if depth == 0 {
+				open = i
+			}
+			depth++
+		case '}':
+			if depth == 0 {
+				continue
+			}
+			depth--
+			if depth > 0 {
+				continue
+			}
+			alts := splitAlternatives(p[open+1 : i])
+			if len(alts) < 2 {
+				continue
+			}
+			var r []string
+			for _, alt := range alts {
+				r = append(r, expandBraces(p[:open]+alt+p[i+1:])...)
+			}
+			return r
+		}
+	}
+	return []string{p}
+}
+
+// splitAlternatives splits on commas not nested in other braces.
+func splitAlternatives(s string) []string {
+	var alts []string
+	start, depth := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				alts = append(alts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(alts, s[start:])
+}
+
+// globMatch reports whether name matches the whole pattern.
+func globMatch(pattern, name string, dot bool) bool {
+	for _, p := range expandBraces(pattern) {
+		if matchSegments(strings.Split(p, "/"), strings.Split(name, "/"), dot) {
+			return true
+		}
+	}
+	return false
+}
+
+// globMatchPrefix reports whether name, or any of its parents, matches the
+// pattern and returns the matching one.
+func globMatchPrefix(pattern, name string, dot bool) (string, bool) {
+	for {
+		if globMatch(pattern, name, dot) {
+			return name, true
+		}
+		i := strings.LastIndex(name, "/")
+		if i <= 0 {
+			return "", false
+		}
+		name = name[:i]
+	}
+}
+
+func matchSegments(pat, name []string, dot bool) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pat[1:], name[i:], dot) {
+					return true
+				}
+				if i < len(name) && !dot && hidden(name[i]) {
+					return false
+				}
+			}
+			return false
+		}
+		if len(name) == 0 || !matchSegment(pat[0], name[0], dot) {
+			return false
+		}
+		pat, name = pat[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+func matchSegment(pat, name string, dot bool) bool {
+	if !dot && hidden(name) && !strings.HasPrefix(pat, ".") {
+		return false
+	}
+	ok, err := filepath.Match(pat, name)
+	return err == nil && ok
+}
+
+func hidden(name string) bool {
+	return strings.HasPrefix(name, ".") && name != "." && name != ".."
+}
+
+// glob returns, sorted and without duplicates, the existing paths matching
+// the pattern.
+func (fs rootFS) glob(pattern string, dot bool) ([]string, error) {
+	seen := make(map[string]bool)
+	var matches []string
+	for _, p := range expandBraces(pattern) {
+		segs := strings.Split(p, "/")
+		i := 0
+		for i < len(segs) && segs[i] != "**" && !hasMeta(segs[i]) {
+			i++
+		}
+		base := strings.Join(segs[:i], "/")
+		switch {
+		case base == "" && strings.HasPrefix(p, "/"):
+			base = "/"
+		case base == "":
+			base = "."
+		}
+		if i == len(segs) {
+			// no wildcard left after expanding braces
+			if _, _, err := fs.lstat(base); err != nil {
+				continue
+			}
+		}
+
+		var found []string
+		err := fs.globDir(base, segs[i:], dot, &found)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range found {
+			if !seen[f] {
+				seen[f] = true
+				matches = append(matches, f)
+			}
+		}
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+func (fs rootFS) globDir(dir string, pat []string, dot bool, found *[]string) error {
+	if len(pat) == 0 {
+		*found = append(*found, dir)
+		return nil
+	}
+
+	if !hasMeta(pat[0]) && pat[0] != "**" {
+		child := filepath.Join(dir, pat[0])
+		if _, _, err := fs.lstat(child); err != nil {
+			return nil
+		}
+		return fs.globDir(child, pat[1:], dot, found)
+	}
+
+	names, err := fs.readDirNames(dir)
+	if err != nil {
+		// not a directory or unreadable, nothing matches
+		return nil
+	}
+
+	if pat[0] == "**" {
+		err = fs.globDir(dir, pat[1:], dot, found)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if !dot && hidden(name) {
+				continue
+			}
+			child := filepath.Join(dir, name)
+			_, info, err := fs.lstat(child)
+			if err != nil || !info.IsDir() {
+				continue
+			}
+			err = fs.globDir(child, pat, dot, found)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, name := range names {
+		if !matchSegment(pat[0], name, dot) {
+			continue
+		}
+		err = fs.globDir(filepath.Join(dir, name), pat[1:], dot, found)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readDirNames(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,148 @@
+package attrs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExpandBraces(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"/etc/nginx", []string{"/etc/nginx"}},
+		{"/etc/{nginx,ssl}", []string{"/etc/nginx", "/etc/ssl"}},
+		{"/{a,b}/{c,d}", []string{"/a/c", "/a/d", "/b/c", "/b/d"}},
+		{"/{a,b{c,d}}", []string{"/a", "/bc", "/bd"}},
+		{"/{a,}x", []string{"/ax", "/x"}},
+		{"/{a}", []string{"/{a}"}},
+		{`/\{a,b}`, []string{`/\{a,b}`}},
+		{"/a}", []string{"/a}"}},
+	}
+	for _, tt := range tests {
+		got := expandBraces(tt.pattern)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("expandBraces(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		dot           bool
+		want          bool
+	}{
+		{"/etc/*.conf", "/etc/a.conf", false, true},
+		{"/etc/*.conf", "/etc/sub/a.conf", false, false},
+		{"/etc/?", "/etc/a", false, true},
+		{"/etc/[ab]", "/etc/c", false, false},
+		{"/srv/**/*.sh", "/srv/a.sh", false, true},
+		{"/srv/**/*.sh", "/srv/a/b/c.sh", false, true},
+		{"/srv/**", "/srv", false, true},
+		{"/srv/**", "/srv/a/b", false, true},
+		{"/etc/{nginx,ssl}/*", "/etc/ssl/cert", false, true},
+		{"/etc/{nginx,ssl}/*", "/etc/apache/cert", false, false},
+
+		// dotfiles
+		{"/home/*", "/home/.profile", false, false},
+		{"/home/*", "/home/.profile", true, true},
+		{"/home/.*", "/home/.profile", false, true},
+		{"/srv/**/*.sh", "/srv/.git/a.sh", false, false},
+		{"/srv/**/*.sh", "/srv/.git/a.sh", true, true},
+		{"/srv/**", "/srv/.git", false, false},
+
+		// escaped literals
+		{escapeGlob("/a[1]"), "/a[1]", false, true},
+		{escapeGlob("/a[1]"), "/a1", false, false},
+		{escapeGlob("/{x,y}*"), "/{x,y}*", false, true},
+		{escapeGlob("/{x,y}*"), "/x", false, false},
+		{escapeGlob(`/a\b?`), `/a\b?`, false, true},
+	}
+	for _, tt := range tests {
+		got := globMatch(tt.pattern, tt.name, tt.dot)
+		if got != tt.want {
+			t.Errorf("globMatch(%q, %q, %v) = %v, want %v", tt.pattern, tt.name, tt.dot, got, tt.want)
+		}
+	}
+}
+
+func TestGlobMatchPrefix(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          string
+		ok            bool
+	}{
+		{"/srv/*", "/srv/a/b/c", "/srv/a", true},
+		{"/srv/*/b", "/srv/a/b/c", "/srv/a/b", true},
+		{"/srv/*.sh", "/srv/a/b", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := globMatchPrefix(tt.pattern, tt.name, false)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("globMatchPrefix(%q, %q) = %q, %v, want %q, %v", tt.pattern, tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestGlob(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fix-attrs-glob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, f := range []string{"a/x.sh", "a/b/y.sh", "a/.git/z.sh", "c/x.sh", "c/.hidden", "d/x.txt"} {
+		p := filepath.Join(dir, f)
+		err := os.MkdirAll(filepath.Dir(p), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(p, nil, 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		pattern string
+		dot     bool
+		want    []string
+	}{
+		{"/*/x.sh", false, []string{"/a/x.sh", "/c/x.sh"}},
+		{"/**/*.sh", false, []string{"/a/b/y.sh", "/a/x.sh", "/c/x.sh"}},
+		{"/**/*.sh", true, []string{"/a/.git/z.sh", "/a/b/y.sh", "/a/x.sh", "/c/x.sh"}},
+		{"/c/*", false, []string{"/c/x.sh"}},
+		{"/c/*", true, []string{"/c/.hidden", "/c/x.sh"}},
+		{"/{a,d}/x.*", false, []string{"/a/x.sh", "/d/x.txt"}},
+		{"/{a,c}/x.sh", false, []string{"/a/x.sh", "/c/x.sh"}},
+		{"/{a,e}/x.sh", false, []string{"/a/x.sh"}},
+		{"/nope/*", false, nil},
+	}
+	for _, root := range []bool{false, true} {
+		for _, tt := range tests {
+			fs := rootFS{root: dir}
+			pattern := tt.pattern
+			if !root {
+				fs = rootFS{}
+				pattern = dir + tt.pattern
+			}
+			got, err := fs.glob(pattern, tt.dot)
+			if err != nil {
+				t.Errorf("glob(%q): %s", pattern, err)
+				continue
+			}
+			for i, g := range got {
+				got[i] = strings.TrimPrefix(g, dir)
+			}
+			if len(got) == 0 && len(tt.want) == 0 {
+				continue
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("glob(%q, %v) with root %v = %q, want %q", tt.pattern, tt.dot, root, got, tt.want)
+			}
+		}
+	}
+}
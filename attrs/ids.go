@@ -0,0 +1,297 @@
+package attrs
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type idOrError struct {
+	id  int
+	err error
+}
+
+// IDs resolves user and group names from passwd and group files, following
+// GNU chown rules: a name is looked up first, then it is used as a numeric
+// id, a leading + forces the numeric interpretation (e.g. +123).
+type IDs struct {
+	passwdPath, groupPath string
+
+	// lazily loaded databases, name to uid/gid and uid to login gid
+	users      map[string]int
+	groups     map[string]int
+	loginGids  map[string]int
+	userNames  map[int]string
+	groupNames map[int]string
+	loadErr    error
+
+	// uid/gid cache
+	uidmap map[string]idOrError
+	gidmap map[string]idOrError
+}
+
+var hostIDs = NewIDs("/")
+
+// NewIDs resolves names using etc/passwd and etc/group below root.
+func NewIDs(root string) *IDs {
+	return &IDs{
+		passwdPath: filepath.Join(root, "etc", "passwd"),
+		groupPath:  filepath.Join(root, "etc", "group"),
+		uidmap:     make(map[string]idOrError),
+		gidmap:     make(map[string]idOrError),
+	}
+}
+
+// LookupUid resolves a user name or numeric id using the host databases.
+func LookupUid(s string) (int, error) {
+	return hostIDs.Uid(s)
+}
+
+// LookupGid resolves a group name or numeric id using the host databases.
+func LookupGid(s string) (int, error) {
+	return hostIDs.Gid(s)
+}
+
+// Uid resolves a user name or numeric id.
+func (ids *IDs) Uid(s string) (int, error) {
+	v, ok := ids.uidmap[s]
+	if !ok {
+		v.id, v.err = ids.lookup(s, "user", func() map[string]int { return ids.users })
+		ids.uidmap[s] = v
+	}
+	return v.id, v.err
+}
+
+// Gid resolves a group name or numeric id.
+func (ids *IDs) Gid(s string) (int, error) {
+	v, ok := ids.gidmap[s]
+	if !ok {
+		v.id, v.err = ids.lookup(s, "group", func() map[string]int { return ids.groups })
+		ids.gidmap[s] = v
+	}
+	return v.id, v.err
+}
+
+// LoginGid returns the primary group of a user.
+func (ids *IDs) LoginGid(s string) (int, error) {
+	err := ids.load()
+	if err != nil {
+		return 0, err
+	}
+	gid, ok := ids.loginGids[s]
+	if !ok {
+		return 0, fmt.Errorf("unable to find login group: %s", s)
+	}
+	return gid, nil
+}
+
+// UserName returns the name of a user id, empty if unknown.
+func (ids *IDs) UserName(uid int) string {
+	if ids.load() != nil {
+		return ""
+	}
+	return ids.userNames[uid]
+}
+
+// GroupName returns the name of a group id, empty if unknown.
+func (ids *IDs) GroupName(gid int) string {
+	if ids.load() != nil {
+		return ""
+	}
+	return ids.groupNames[gid]
+}
+
+func (ids *IDs) lookup(s, kind string, db func() map[string]int) (int, error) {
+	if strings.HasPrefix(s, "+") {
+		id, err := parseID(s[1:])
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s: %s", kind, s)
+		}
+		return id, nil
+	}
+
+	err := ids.load()
+	if err != nil {
+		return 0, err
+	}
+	if id, ok := db()[s]; ok {
+		return id, nil
+	}
+	id, err := parseID(s)
+	if err != nil {
+		return 0, fmt.Errorf("unknown %s: %s", kind, s)
+	}
+	return id, nil
+}
+
+func parseID(s string) (int, error) {
+	id, err := strconv.ParseUint(s, 10, 32)
+	return int(id), err
+}
+
+// load reads both databases once, missing files are treated as empty.
+func (ids *IDs) load() error {
+	if ids.users != nil || ids.loadErr != nil {
+		return ids.loadErr
+	}
+
+	ids.users = make(map[string]int)
+	ids.groups = make(map[string]int)
+	ids.loginGids = make(map[string]int)
+	ids.userNames = make(map[int]string)
+	ids.groupNames = make(map[int]string)
+	ids.loadErr = readColonFile(ids.passwdPath, func(fields []string) {
+		// name:password:uid:gid:gecos:home:shell
+		if len(fields) < 4 {
+			return
+		}
+		uid, err := parseID(fields[2])
+		if err != nil {
+			return
+		}
+		gid, err := parseID(fields[3])
+		if err != nil {
+			return
+		}
+		if _, ok := ids.users[fields[0]]; !ok {
+			ids.users[fields[0]] = uid
+			ids.loginGids[fields[0]] = gid
+		}
+		if _, ok := ids.userNames[uid]; !ok {
+			ids.userNames[uid] = fields[0]
+		}
+	})
+	if ids.loadErr != nil {
+		return ids.loadErr
+	}
+	ids.loadErr = readColonFile(ids.groupPath, func(fields []string) {
+		// name:password:gid:members
+		if len(fields) < 3 {
+			return
+		}
+		gid, err := parseID(fields[2])
+		if err != nil {
+			return
+		}
+		if _, ok := ids.groups[fields[0]]; !ok {
+			ids.groups[fields[0]] = gid
+		}
+		if _, ok := ids.groupNames[gid]; !ok {
+			ids.groupNames[gid] = fields[0]
+		}
+	})
+	return ids.loadErr
+}
+
+// readColonFile calls fn with the fields of every entry of a passwd(5) like
+// file, skipping comments and NIS compat entries.
+func readColonFile(path string, fn func(fields []string)) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' || line[0] == '+' || line[0] == '-' {
+			continue
+		}
+		fn(strings.Split(line, ":"))
+	}
+	return sc.Err()
+}
+
+// Resolve looks up every user and group name of the spec, failing on the
+// first unknown one. Resolved attributes no longer depend on name lookups.
+func (s *Spec) Resolve(ids *IDs) error {
+	for _, r := range s.rules() {
+		for _, a := range []*Attr{&r.Dir, &r.File} {
+			err := a.resolve(ids)
+			if err != nil {
+				return fmt.Errorf("%s (%s): %s", r.Path, r.Source, err)
+			}
+		}
+	}
+	return nil
+}
+
+// resolve looks up uid and gid, the s6 fallback replaces each one that
+// can't be found on its own.
+func (a *Attr) resolve(ids *IDs) error {
+	uid, uerr := a.lookupUid(ids)
+	gid, gerr := a.lookupGid(ids)
+	if (uerr != nil || gerr != nil) && a.fallback != "" {
+		fuid, fgid, err := parseFallback(a.fallback)
+		if err != nil {
+			return err
+		}
+		if uerr != nil {
+			uid, uerr = fuid, nil
+		}
+		if gerr != nil {
+			gid, gerr = fgid, nil
+		}
+	}
+	if uerr != nil {
+		return uerr
+	}
+	if gerr != nil {
+		return gerr
+	}
+	a.uid, a.gid, a.resolved = uid, gid, true
+	return nil
+}
+
+// ids returns the numeric uid and gid of the attributes, -1 stands for
+// unchanged. Unresolved attributes are looked up in the host databases.
+func (a Attr) ids() (int, int, error) {
+	if !a.resolved {
+		err := a.resolve(hostIDs)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	return a.uid, a.gid, nil
+}
+
+func (a Attr) lookupUid(ids *IDs) (int, error) {
+	if a.Uid == "" {
+		return -1, nil
+	}
+	return ids.Uid(a.Uid)
+}
+
+func (a Attr) lookupGid(ids *IDs) (int, error) {
+	switch {
+	case a.loginGroup:
+		return ids.LoginGid(a.Uid)
+	case a.Gid == "":
+		return -1, nil
+	}
+	return ids.Gid(a.Gid)
+}
+
+// parseFallback parses a numeric uid[:gid], gid defaults to uid.
+func parseFallback(s string) (int, int, error) {
+	parts := strings.SplitN(s, ":", 2)
+	uid, err := parseID(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid fallback uid: %s", s)
+	}
+	gid := uid
+	if len(parts) == 2 {
+		gid, err = parseID(parts[1])
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid fallback gid: %s", s)
+		}
+	}
+	return uid, gid, nil
+}
@@ -0,0 +1,182 @@
+package attrs
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+)
+
+// JournalRecord is the state of a path before it was changed.
+type JournalRecord struct {
+	Path string `json:"path"`
+	Uid  int    `json:"uid"`
+	Gid  int    `json:"gid"`
+	Mode string `json:"mode"`
+}
+
+// Journal wraps an applier, recording the current ownership and mode of
+// every path into w, one JSON record per line, before changing it. Records
+// are written unbuffered so they survive a crash halfway.
+type Journal struct {
+	Applier Applier
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJournal returns an applier journaling into w before delegating to ap.
+func NewJournal(w io.Writer, ap Applier) *Journal {
+	return &Journal{Applier: ap, w: w}
+}
+
+func (j *Journal) Apply(path string, info os.FileInfo, a Attr) error {
+	rec, err := newJournalRecord(path, info)
+	if err != nil {
+		return err
+	}
+	d, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	_, err = j.w.Write(append(d, '\n'))
+	j.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("unable to write journal: %s", err)
+	}
+	return j.Applier.Apply(path, info, a)
+}
+
+func (j *Journal) Flush() error {
+	return flush(j.Applier)
+}
+
+func newJournalRecord(path string, info os.FileInfo) (JournalRecord, error) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return JournalRecord{}, fmt.Errorf("unable to stat: %s", info.Name())
+	}
+	return JournalRecord{
+		Path: path,
+		Uid:  int(st.Uid),
+		Gid:  int(st.Gid),
+		Mode: fmt.Sprintf("%04o", UnixPerm(info.Mode())),
+	}, nil
+}
+
+// recorder keeps the attributes of every path before delegating to the
+// applier, in memory, for atomic mode.
+type recorder struct {
+	Applier Applier
+
+	mu      sync.Mutex
+	records []JournalRecord
+}
+
+func (r *recorder) Apply(path string, info os.FileInfo, a Attr) error {
+	rec, err := newJournalRecord(path, info)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.records = append(r.records, rec)
+	r.mu.Unlock()
+	return r.Applier.Apply(path, info, a)
+}
+
+func (r *recorder) Flush() error {
+	return flush(r.Applier)
+}
+
+// ReadJournal parses every record of a journal, in the order they were
+// written.
+func ReadJournal(r io.Reader) ([]JournalRecord, error) {
+	var records []JournalRecord
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; s.Scan(); n++ {
+		if len(s.Bytes()) == 0 {
+			continue
+		}
+		var rec JournalRecord
+		err := json.Unmarshal(s.Bytes(), &rec)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		records = append(records, rec)
+	}
+	return records, s.Err()
+}
+
+// Rollback restores the attributes recorded in a journal, newest first, so
+// a path changed several times ends up as it was before the first change.
+// Only Applier and KeepGoing options are used.
+func Rollback(ctx context.Context, r io.Reader, opts Options) error {
+	ap := opts.Applier
+	if ap == nil {
+		ap = &NativeApplier{}
+	}
+	records, err := ReadJournal(r)
+	if err != nil {
+		return err
+	}
+	return rollback(ctx, records, ap, opts.KeepGoing)
+}
+
+func rollback(ctx context.Context, records []JournalRecord, ap Applier, keepGoing bool) error {
+	var failures Failures
+	for i := len(records) - 1; i >= 0; i-- {
+		err := ctx.Err()
+		if err != nil {
+			return err
+		}
+
+		rec := records[i]
+		err = rec.restore(ap)
+		if err != nil {
+			if !keepGoing {
+				return fmt.Errorf("%s: %s", rec.Path, err)
+			}
+			failures = append(failures, Failure{Path: rec.Path, Err: err})
+		}
+	}
+
+	// deferred changes, if any
+	err := flush(ap)
+	if ff, ok := err.(Failures); ok {
+		if !keepGoing {
+			return fmt.Errorf("%s: %s", ff[0].Path, ff[0].Err)
+		}
+		failures = append(failures, ff...)
+	} else if err != nil {
+		return err
+	}
+	if len(failures) > 0 {
+		return failures
+	}
+	return nil
+}
+
+func (rec JournalRecord) restore(ap Applier) error {
+	_, err := ParsePerm(rec.Mode)
+	if err != nil {
+		return err
+	}
+	info, err := os.Lstat(rec.Path)
+	if err != nil {
+		return err
+	}
+	// ids are forced numeric, names may have changed since
+	a := Attr{
+		Uid:  "+" + strconv.Itoa(rec.Uid),
+		Gid:  "+" + strconv.Itoa(rec.Gid),
+		Perm: rec.Mode,
+	}
+	return ap.Apply(rec.Path, info, a)
+}
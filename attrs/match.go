@@ -0,0 +1,112 @@
+package attrs
+
+import (
+	"path"
+	"strings"
+)
+
+// kinds of match, from least to most specific
+const (
+	matchNone = iota
+	matchRecursive
+	matchGlob
+	matchExact
+)
+
+// specificity tells how precisely a rule targets a path.
+type specificity struct {
+	kind  int
+	depth int
+}
+
+func (s specificity) less(o specificity) bool {
+	if s.kind != o.kind {
+		return s.kind < o.kind
+	}
+	return s.depth < o.depth
+}
+
+// match reports how specifically the rule covers p, kind is matchNone if it
+// does not cover it at all.
+func (r *Rule) match(p string) specificity {
+	if r.container() {
+		return specificity{}
+	}
+	depth := strings.Count(r.Path, "/")
+	dot := !r.SkipDotfiles
+	switch {
+	case r.Recursive && isGlob(r.Path):
+		root, ok := globMatchPrefix(r.Path, p, dot)
+		if ok && !r.excluded(root, p) {
+			return specificity{kind: matchRecursive, depth: depth}
+		}
+	case r.Recursive:
+		if under(p, r.Path) {
+			if !r.excluded(r.Path, p) {
+				return specificity{kind: matchRecursive, depth: depth}
+			}
+		}
+	case isGlob(r.Path):
+		if globMatch(r.Path, p, dot) && !r.excluded(path.Dir(p), p) {
+			return specificity{kind: matchGlob, depth: depth}
+		}
+	case p == r.Path:
+		return specificity{kind: matchExact, depth: depth}
+	}
+	return specificity{}
+}
+
+// under reports whether p is root or below it, "." covering every relative
+// path that doesn't go up.
+func under(p, root string) bool {
+	if root == "." {
+		return p != ".." && !strings.HasPrefix(p, "../") && !path.IsAbs(p)
+	}
+	return p == root || strings.HasPrefix(p, strings.TrimSuffix(root, "/")+"/")
+}
+
+// excluded reports whether p, below root, matches any of the exclude
+// patterns of the rule. Patterns are relative to root, those without a slash
+// match a file or directory name at any depth.
+func (r *Rule) excluded(root, p string) bool {
+	if len(r.Exclude) == 0 || p == root {
+		return false
+	}
+	rel := p
+	if root != "." {
+		rel = strings.TrimPrefix(p, strings.TrimSuffix(root, "/")+"/")
+	}
+	segs := strings.Split(rel, "/")
+	for _, e := range r.Exclude {
+		if !strings.Contains(e, "/") {
+			for _, seg := range segs {
+				if globMatch(e, seg, true) {
+					return true
+				}
+			}
+			continue
+		}
+		if _, ok := globMatchPrefix(strings.Trim(e, "/"), rel, true); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// owner returns the rule that takes precedence for p: an exact path wins
+// over a glob, which wins over a recursive rule, among recursive rules the
+// deepest one wins. Ties are won by the last declared rule.
+func owner(rules []*Rule, p string) *Rule {
+	var best *Rule
+	var bestSpec specificity
+	for _, r := range rules {
+		s := r.match(p)
+		if s.kind == matchNone {
+			continue
+		}
+		if best == nil || !s.less(bestSpec) {
+			best, bestSpec = r, s
+		}
+	}
+	return best
+}
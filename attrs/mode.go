@@ -0,0 +1,222 @@
+package attrs
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// permission bits of each class, special ones included
+const (
+	classUser  = 04700
+	classGroup = 02070
+	classOther = 01007
+	classAll   = classUser | classGroup | classOther
+)
+
+// Mode is a parsed permission, either octal or symbolic as accepted by
+// chmod, e.g. "0755", "u=rwX,g=rX,o=" or "a-w,u+s".
+type Mode struct {
+	octal   bool
+	perm    uint32
+	clauses []modeClause
+}
+
+type modeClause struct {
+	who uint32
+	ops []modeOp
+}
+
+type modeOp struct {
+	op    byte
+	perms string
+}
+
+// ParseMode parses an octal or symbolic mode.
+func ParseMode(s string) (Mode, error) {
+	if s != "" && strings.Trim(s, "01234567") == "" {
+		mode, err := ParsePerm(s)
+		if err != nil {
+			return Mode{}, err
+		}
+		return Mode{octal: true, perm: UnixPerm(mode)}, nil
+	}
+
+	var m Mode
+	for _, clause := range strings.Split(s, ",") {
+		c, err := parseModeClause(clause)
+		if err != nil {
+			return Mode{}, fmt.Errorf("invalid mode: %s", s)
+		}
+		m.clauses = append(m.clauses, c)
+	}
+	return m, nil
+}
+
+func parseModeClause(s string) (modeClause, error) {
+	var c modeClause
+	i := 0
+	for ; i < len(s) && strings.IndexByte("ugoa", s[i]) >= 0; i++ {
+		switch s[i] {
+		case 'u':
+			c.who |= classUser
+		case 'g':
+			c.who |= classGroup
+		case 'o':
+			c.who |= classOther
+		case 'a':
+			c.who |= classAll
+		}
+	}
+	if i == len(s) {
+		return c, fmt.Errorf("missing operator")
+	}
+	for i < len(s) {
+		op := modeOp{op: s[i]}
+		if op.op != '+' && op.op != '-' && op.op != '=' {
+			return c, fmt.Errorf("invalid operator: %c", s[i])
+		}
+		i++
+		start := i
+		for i < len(s) && strings.IndexByte("+-=", s[i]) < 0 {
+			i++
+		}
+		op.perms = s[start:i]
+		if !validModePerms(op.perms) {
+			return c, fmt.Errorf("invalid permissions: %s", op.perms)
+		}
+		c.ops = append(c.ops, op)
+	}
+	return c, nil
+}
+
+// validModePerms accepts a set of rwxXst letters or a single class to copy.
+func validModePerms(perms string) bool {
+	if perms == "u" || perms == "g" || perms == "o" {
+		return true
+	}
+	return strings.Trim(perms, "rwxXst") == ""
+}
+
+// Apply computes the new mode of a file given its current one. Symbolic
+// modes without a class apply to all of them, umask is not taken into
+// account.
+func (m Mode) Apply(cur os.FileMode, isDir bool) os.FileMode {
+	if m.octal {
+		return fileMode(m.perm)
+	}
+
+	perm := UnixPerm(cur)
+	for _, c := range m.clauses {
+		who := c.who
+		if who == 0 {
+			who = classAll
+		}
+		for _, op := range c.ops {
+			bits := modeBits(op.perms, perm, isDir) & who
+			switch op.op {
+			case '+':
+				perm |= bits
+			case '-':
+				perm &^= bits
+			case '=':
+				perm = perm&^who | bits
+			}
+		}
+	}
+	return fileMode(perm)
+}
+
+// modeBits expands permission letters into bits for every class, the
+// caller masks the ones not affected.
+func modeBits(perms string, cur uint32, isDir bool) uint32 {
+	switch perms {
+	case "u":
+		return copyClass((cur >> 6) & 07)
+	case "g":
+		return copyClass((cur >> 3) & 07)
+	case "o":
+		return copyClass(cur & 07)
+	}
+
+	var bits uint32
+	for _, p := range perms {
+		switch p {
+		case 'r':
+			bits |= 0444
+		case 'w':
+			bits |= 0222
+		case 'x':
+			bits |= 0111
+		case 'X':
+			// execute only for directories or already executable files
+			if isDir || cur&0111 != 0 {
+				bits |= 0111
+			}
+		case 's':
+			bits |= 06000
+		case 't':
+			bits |= 01000
+		}
+	}
+	return bits
+}
+
+func copyClass(rwx uint32) uint32 {
+	return rwx<<6 | rwx<<3 | rwx
+}
+
+func (m Mode) String() string {
+	if m.octal {
+		return fmt.Sprintf("%04o", m.perm)
+	}
+
+	var clauses []string
+	for _, c := range m.clauses {
+		s := ""
+		if c.who&classAll == classAll {
+			s = "a"
+		} else {
+			if c.who&classUser == classUser {
+				s += "u"
+			}
+			if c.who&classGroup == classGroup {
+				s += "g"
+			}
+			if c.who&classOther == classOther {
+				s += "o"
+			}
+		}
+		for _, op := range c.ops {
+			s += string(op.op) + op.perms
+		}
+		clauses = append(clauses, s)
+	}
+	return strings.Join(clauses, ",")
+}
+
+// ParsePerm converts an octal permission string, as typed in a shell, into
+// an os.FileMode including setuid, setgid and sticky bits.
+func ParsePerm(s string) (os.FileMode, error) {
+	perm, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || perm > 07777 {
+		return 0, fmt.Errorf("invalid octal permission: %s", s)
+	}
+	return fileMode(uint32(perm)), nil
+}
+
+// fileMode converts octal permission bits into an os.FileMode.
+func fileMode(perm uint32) os.FileMode {
+	mode := os.FileMode(perm & 0777)
+	if perm&04000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if perm&02000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if perm&01000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode
+}
@@ -0,0 +1,106 @@
+package attrs
+
+import (
+	"testing"
+)
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		mode string
+		ok   bool
+	}{
+		{"0755", true},
+		{"755", true},
+		{"4755", true},
+		{"17777", false},
+		{"0758", false},
+		{"u=rwX,g=rX,o=", true},
+		{"a-w,u+s", true},
+		{"+t", true},
+		{"g=u", true},
+		{"u+r-w=x", true},
+		{"", false},
+		{"u", false},
+		{"u*r", false},
+		{"u=rq", false},
+		{"g=uo", false},
+		{"u=rw,", false},
+	}
+	for _, tt := range tests {
+		_, err := ParseMode(tt.mode)
+		if (err == nil) != tt.ok {
+			t.Errorf("ParseMode(%q) error = %v, want ok %v", tt.mode, err, tt.ok)
+		}
+	}
+}
+
+func TestModeApply(t *testing.T) {
+	tests := []struct {
+		mode  string
+		cur   uint32
+		isDir bool
+		want  uint32
+	}{
+		// octal replaces every bit
+		{"0640", 04755, false, 0640},
+		{"2750", 0755, true, 02750},
+
+		{"u=rw,g=r,o=", 0777, false, 0640},
+		{"a-w", 0666, false, 0444},
+		{"+x", 0644, false, 0755},
+		{"go-rwx", 0755, false, 0700},
+		{"u+r-w=x", 0644, false, 0144},
+
+		// X only for directories or executable files
+		{"a+X", 0644, false, 0644},
+		{"a+X", 0744, false, 0755},
+		{"a+X", 0600, true, 0711},
+		{"u=rwX,g=rX,o=", 0600, true, 0750},
+		{"u=rwX,g=rX,o=", 0666, false, 0640},
+
+		// copying classes
+		{"g=u", 0740, false, 0770},
+		{"o=g", 0750, false, 0755},
+		{"go=u", 0700, false, 0777},
+
+		// special bits
+		{"u+s", 0755, false, 04755},
+		{"g+s", 0755, true, 02755},
+		{"+t", 0777, true, 01777},
+		{"a-s", 06755, false, 0755},
+		{"o-t", 01777, true, 0777},
+		{"u=rwx", 04755, false, 0755},
+	}
+	for _, tt := range tests {
+		m, err := ParseMode(tt.mode)
+		if err != nil {
+			t.Errorf("ParseMode(%q): %s", tt.mode, err)
+			continue
+		}
+		got := UnixPerm(m.Apply(fileMode(tt.cur), tt.isDir))
+		if got != tt.want {
+			t.Errorf("%q applied to %04o (dir %v) = %04o, want %04o", tt.mode, tt.cur, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+func TestModeString(t *testing.T) {
+	tests := []struct {
+		mode, want string
+	}{
+		{"755", "0755"},
+		{"u=rwX,g=rX,o=", "u=rwX,g=rX,o="},
+		{"ugo+x", "a+x"},
+		{"+t", "+t"},
+	}
+	for _, tt := range tests {
+		m, err := ParseMode(tt.mode)
+		if err != nil {
+			t.Errorf("ParseMode(%q): %s", tt.mode, err)
+			continue
+		}
+		if got := m.String(); got != tt.want {
+			t.Errorf("ParseMode(%q).String() = %q, want %q", tt.mode, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,496 @@
+package attrs
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	mediaTypeOCIIndex     = "application/vnd.oci.image.index.v1+json"
+	mediaTypeDockerList   = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeDockerImage  = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeOCILayerGzip = "application/vnd.oci.image.layer.v1.tar+gzip"
+	mediaTypeDockerLayer  = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+
+	refNameAnnotation = "org.opencontainers.image.ref.name"
+
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq"
+)
+
+// LayoutOptions tweak how an OCI image layout is fixed.
+type LayoutOptions struct {
+	Options
+
+	// Ref selects the manifest by its org.opencontainers.image.ref.name
+	// annotation, required if the index lists more than one.
+	Ref string
+
+	// RewriteTop replaces the top layer instead of appending a new one.
+	RewriteTop bool
+}
+
+// FixLayout fixes the image of an OCI image layout directory at build time,
+// without root: every path of the image, as seen after applying all its
+// layers and whiteouts, matched by the spec and whose attributes differ is
+// written to a new layer. Config, manifest and index are updated with the
+// new digests, old blobs are left in place. It returns the number of
+// entries changed, no layer is added if it is zero.
+func FixLayout(ctx context.Context, dir string, spec *Spec, opts LayoutOptions) (int, error) {
+	rt, err := newTarRewriter(spec, opts.Options)
+	if err != nil {
+		return 0, err
+	}
+
+	l := &layout{dir: dir}
+	index, desc, err := l.manifestDescriptor(opts.Ref)
+	if err != nil {
+		return 0, err
+	}
+	var manifest map[string]interface{}
+	err = l.readJSON(desc, &manifest)
+	if err != nil {
+		return 0, err
+	}
+	configDesc, _ := manifest["config"].(map[string]interface{})
+	var config map[string]interface{}
+	err = l.readJSON(configDesc, &config)
+	if err != nil {
+		return 0, err
+	}
+	layers, _ := manifest["layers"].([]interface{})
+	if len(layers) == 0 && opts.RewriteTop {
+		return 0, fmt.Errorf("image has no layers to rewrite")
+	}
+
+	// merged view of the image, then the entries to write
+	view, err := l.view(ctx, layers)
+	if err != nil {
+		return 0, err
+	}
+	top := -1
+	if opts.RewriteTop {
+		top = len(layers) - 1
+	}
+	changes := make(map[int]map[int]*tar.Header)
+	n := 0
+	for _, e := range view {
+		hdr := *e.hdr
+		if !rt.rewrite(&hdr) {
+			continue
+		}
+		if changes[e.layer] == nil {
+			changes[e.layer] = make(map[int]*tar.Header)
+		}
+		changes[e.layer][e.pos] = &hdr
+		n++
+	}
+	if n == 0 {
+		return 0, nil
+	}
+
+	mediaType := mediaTypeOCILayerGzip
+	if manifest["mediaType"] == mediaTypeDockerImage {
+		mediaType = mediaTypeDockerLayer
+	}
+	layerDesc, diffID, err := l.writeLayer(ctx, layers, changes, top, rt, mediaType)
+	if err != nil {
+		return 0, err
+	}
+
+	// config
+	rootfs, _ := config["rootfs"].(map[string]interface{})
+	if rootfs == nil {
+		return 0, fmt.Errorf("image config without rootfs")
+	}
+	diffIDs, _ := rootfs["diff_ids"].([]interface{})
+	if opts.RewriteTop {
+		if len(diffIDs) != len(layers) {
+			return 0, fmt.Errorf("image config diff_ids don't match its layers")
+		}
+		diffIDs[len(diffIDs)-1] = diffID
+		layers[len(layers)-1] = layerDesc
+	} else {
+		diffIDs = append(diffIDs, diffID)
+		layers = append(layers, layerDesc)
+		history, _ := config["history"].([]interface{})
+		config["history"] = append(history, map[string]interface{}{
+			"created":    time.Now().UTC().Format(time.RFC3339),
+			"created_by": "fix-attrs",
+			"comment":    "fix attributes",
+		})
+	}
+	rootfs["diff_ids"] = diffIDs
+	manifest["layers"] = layers
+
+	newConfigDesc, err := l.writeJSON(config, configDesc)
+	if err != nil {
+		return 0, err
+	}
+	manifest["config"] = newConfigDesc
+	newDesc, err := l.writeJSON(manifest, desc)
+	if err != nil {
+		return 0, err
+	}
+	for k, v := range newDesc {
+		desc[k] = v
+	}
+
+	d, err := json.Marshal(index)
+	if err != nil {
+		return 0, err
+	}
+	return n, writeFileAtomic(filepath.Join(dir, "index.json"), d)
+}
+
+// layout is an OCI image layout directory.
+type layout struct {
+	dir string
+}
+
+// manifestDescriptor returns the parsed index and the descriptor of the
+// selected manifest, changes to the latter are reflected in the former.
+func (l *layout) manifestDescriptor(ref string) (map[string]interface{}, map[string]interface{}, error) {
+	f, err := os.Open(filepath.Join(l.dir, "index.json"))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	var index map[string]interface{}
+	err = decodeJSON(f, &index)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	manifests, _ := index["manifests"].([]interface{})
+	var found []map[string]interface{}
+	for _, m := range manifests {
+		desc, ok := m.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		annotations, _ := desc["annotations"].(map[string]interface{})
+		if ref == "" || annotations[refNameAnnotation] == ref {
+			found = append(found, desc)
+		}
+	}
+	switch {
+	case len(found) == 0 && ref != "":
+		return nil, nil, fmt.Errorf("no manifest found with ref: %s", ref)
+	case len(found) == 0:
+		return nil, nil, fmt.Errorf("no manifest found in index")
+	case len(found) > 1:
+		return nil, nil, fmt.Errorf("more than one manifest found, please select one by ref")
+	}
+
+	desc := found[0]
+	if desc["mediaType"] == mediaTypeOCIIndex || desc["mediaType"] == mediaTypeDockerList {
+		return nil, nil, fmt.Errorf("nested indexes are not supported")
+	}
+	return index, desc, nil
+}
+
+func (l *layout) blobPath(desc map[string]interface{}) (string, error) {
+	digest, _ := desc["digest"].(string)
+	parts := strings.SplitN(digest, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || strings.ContainsAny(parts[1], "/.") {
+		return "", fmt.Errorf("invalid digest: %q", digest)
+	}
+	return filepath.Join(l.dir, "blobs", parts[0], parts[1]), nil
+}
+
+func (l *layout) readJSON(desc map[string]interface{}, v interface{}) error {
+	p, err := l.blobPath(desc)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return decodeJSON(f, v)
+}
+
+// writeJSON stores v as a blob and returns its descriptor, based on the one
+// it replaces.
+func (l *layout) writeJSON(v interface{}, old map[string]interface{}) (map[string]interface{}, error) {
+	d, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(d)
+	desc := make(map[string]interface{})
+	for k, v := range old {
+		desc[k] = v
+	}
+	desc["digest"] = "sha256:" + hex.EncodeToString(sum[:])
+	desc["size"] = len(d)
+
+	p, err := l.blobPath(desc)
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(filepath.Dir(p), 0755)
+	if err != nil {
+		return nil, err
+	}
+	return desc, writeFileAtomic(p, d)
+}
+
+// openLayer returns the uncompressed tar stream of a layer.
+func (l *layout) openLayer(desc interface{}) (io.ReadCloser, error) {
+	d, _ := desc.(map[string]interface{})
+	p, err := l.blobPath(d)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(f)
+	magic, _ := br.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return readCloser{gz, f}, nil
+	case bytes.Equal(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		f.Close()
+		return nil, fmt.Errorf("zstd compressed layers are not supported")
+	}
+	return readCloser{br, f}, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// viewEntry is a file of the merged image and where it comes from.
+type viewEntry struct {
+	hdr   *tar.Header
+	layer int
+	pos   int
+}
+
+// view applies every layer, whiteouts included, and returns the resulting
+// files sorted by path.
+func (l *layout) view(ctx context.Context, layers []interface{}) ([]viewEntry, error) {
+	files := make(map[string]viewEntry)
+	for i, desc := range layers {
+		err := ctx.Err()
+		if err != nil {
+			return nil, err
+		}
+
+		var entries []viewEntry
+		var removed, opaque []string
+		err = l.readLayer(desc, func(pos int, hdr *tar.Header, r io.Reader) error {
+			p := path.Clean("/" + hdr.Name)
+			base := path.Base(p)
+			switch {
+			case base == whiteoutOpaque:
+				opaque = append(opaque, path.Dir(p))
+			case strings.HasPrefix(base, whiteoutPrefix):
+				removed = append(removed, path.Join(path.Dir(p), base[len(whiteoutPrefix):]))
+			default:
+				entries = append(entries, viewEntry{hdr: hdr, layer: i, pos: pos})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// whiteouts only hide files from lower layers
+		for p := range files {
+			for _, r := range removed {
+				if p == r || strings.HasPrefix(p, r+"/") {
+					delete(files, p)
+				}
+			}
+			for _, o := range opaque {
+				if strings.HasPrefix(p, strings.TrimSuffix(o, "/")+"/") {
+					delete(files, p)
+				}
+			}
+		}
+		for _, e := range entries {
+			files[path.Clean("/"+e.hdr.Name)] = e
+		}
+	}
+
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	view := make([]viewEntry, len(paths))
+	for i, p := range paths {
+		view[i] = files[p]
+	}
+	return view, nil
+}
+
+func (l *layout) readLayer(desc interface{}, fn func(pos int, hdr *tar.Header, r io.Reader) error) error {
+	rc, err := l.openLayer(desc)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	tr := tar.NewReader(rc)
+	for pos := 0; ; pos++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		err = fn(pos, hdr, tr)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// writeLayer writes the changed entries, with their content, as a gzip
+// compressed layer blob. If top is a layer index, every entry of it is
+// kept as well, rewritten, as it is going to be replaced.
+func (l *layout) writeLayer(ctx context.Context, layers []interface{}, changes map[int]map[int]*tar.Header, top int, rt *tarRewriter, mediaType string) (map[string]interface{}, string, error) {
+	blobs := filepath.Join(l.dir, "blobs", "sha256")
+	err := os.MkdirAll(blobs, 0755)
+	if err != nil {
+		return nil, "", err
+	}
+	f, err := ioutil.TempFile(blobs, ".fix-attrs-")
+	if err != nil {
+		return nil, "", err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	digest := newDigester(f)
+	gz := gzip.NewWriter(digest)
+	diffID := newDigester(gz)
+	tw := tar.NewWriter(diffID)
+
+	for i, desc := range layers {
+		if len(changes[i]) == 0 && i != top {
+			continue
+		}
+		err := ctx.Err()
+		if err != nil {
+			return nil, "", err
+		}
+
+		err = l.readLayer(desc, func(pos int, hdr *tar.Header, r io.Reader) error {
+			newHdr, ok := changes[i][pos]
+			if !ok && i != top {
+				return nil
+			}
+			if !ok {
+				newHdr = hdr
+				if !strings.HasPrefix(path.Base(hdr.Name), whiteoutPrefix) {
+					rt.rewrite(newHdr)
+				}
+			}
+			err := tw.WriteHeader(newHdr)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(tw, r)
+			return err
+		})
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	err = tw.Close()
+	if err == nil {
+		err = gz.Close()
+	}
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	desc := map[string]interface{}{
+		"mediaType": mediaType,
+		"digest":    digest.digest(),
+		"size":      digest.n,
+	}
+	p, err := l.blobPath(desc)
+	if err != nil {
+		return nil, "", err
+	}
+	err = os.Rename(f.Name(), p)
+	if err != nil {
+		return nil, "", err
+	}
+	return desc, diffID.digest(), nil
+}
+
+// digester computes the sha256 digest and size of what is written through
+// it.
+type digester struct {
+	w io.Writer
+	h hash.Hash
+	n int64
+}
+
+func newDigester(w io.Writer) *digester {
+	return &digester{w: w, h: sha256.New()}
+}
+
+func (d *digester) Write(p []byte) (int, error) {
+	n, err := d.w.Write(p)
+	d.h.Write(p[:n])
+	d.n += int64(n)
+	return n, err
+}
+
+func (d *digester) digest() string {
+	return "sha256:" + hex.EncodeToString(d.h.Sum(nil))
+}
+
+func decodeJSON(r io.Reader, v interface{}) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+func writeFileAtomic(p string, d []byte) error {
+	tmp := p + ".tmp"
+	err := ioutil.WriteFile(tmp, d, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
@@ -0,0 +1,397 @@
+package attrs
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	json "encoding/json"
+	toml "github.com/BurntSushi/toml"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	JSON = "json"
+	YAML = "yml"
+	TOML = "toml"
+	S6   = "s6"
+
+	TMPFILES = "tmpfiles"
+)
+
+// DetectFormat guesses configuration format based on file extension,
+// defaults to JSON.
+func DetectFormat(filePath string) string {
+	format := strings.ToLower(filepath.Ext(filePath))
+	if format == "" {
+		return JSON
+	}
+	return NormalizeFormat(format[1:])
+}
+
+// NormalizeFormat maps format aliases to their canonical name.
+func NormalizeFormat(format string) string {
+	format = strings.ToLower(format)
+	switch format {
+	case "yaml":
+		return YAML
+	case "conf":
+		return TMPFILES
+	}
+	return format
+}
+
+// Parse reads a configuration in the given format.
+func Parse(r io.Reader, format string) (*Spec, error) {
+	d, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var i interface{}
+	switch NormalizeFormat(format) {
+	case JSON:
+		err = json.Unmarshal(d, &i)
+	case YAML:
+		err = yaml.Unmarshal(d, &i)
+	case TOML:
+		i, err = decodeToml(d)
+	case S6:
+		spec := &Spec{}
+		err = parseS6(d, spec)
+		if err != nil {
+			return nil, err
+		}
+		return spec, nil
+	case TMPFILES:
+		spec := &Spec{}
+		err = parseTmpfiles(d, spec)
+		if err != nil {
+			return nil, err
+		}
+		return spec, nil
+	default:
+		return nil, fmt.Errorf("unsupported format: %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if i == nil {
+		return nil, fmt.Errorf("unable to parse, no content or invalid format provided")
+	}
+
+	spec := &Spec{}
+	err = iterRoot(i, "$", spec)
+	if err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// ParseDir parses every regular file in dir, in lexical order, into a
+// single spec, as s6-overlay does with /etc/fix-attrs.d.
+func ParseDir(dir string, format string) (*Spec, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	spec := &Spec{}
+	for _, info := range infos {
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		f, err := os.Open(filepath.Join(dir, info.Name()))
+		if err != nil {
+			return nil, err
+		}
+		s, err := Parse(f, format)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", info.Name(), err)
+		}
+		for _, r := range s.rules() {
+			r.Source = info.Name() + " " + r.Source
+		}
+		for _, w := range s.Warnings {
+			spec.Warnings = append(spec.Warnings, info.Name()+" "+w)
+		}
+		spec.Rules = append(spec.Rules, s.Rules...)
+	}
+	return spec, nil
+}
+
+func iterRoot(i interface{}, src string, spec *Spec) error {
+	switch ii := i.(type) {
+	case []interface{}:
+		for n, v := range ii {
+			err := iterRoot(v, fmt.Sprintf("%s[%d]", src, n), spec)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case map[string]interface{}, map[interface{}]interface{}:
+		m, err := prepareFile(ii)
+		if err != nil {
+			return err
+		}
+		r, err := iterFile("", src, m)
+		if err != nil {
+			return err
+		}
+		spec.Rules = append(spec.Rules, r)
+		return nil
+	default:
+		return fmt.Errorf("unsupported entry: %v", ii)
+	}
+}
+
+func iterFile(parentPath, src string, m map[string]interface{}) (Rule, error) {
+	pathVal, err := stringval(m, "path")
+	if err != nil {
+		return Rule{}, err
+	}
+	recursive := false
+	recursiveVal, err := boolval(m, "recursive")
+	if err == nil {
+		recursive = recursiveVal
+	}
+	exclude, err := stringsval(m, "exclude")
+	if err != nil && !isKeyNotFound(err) {
+		return Rule{}, fmt.Errorf("%s: %s", pathVal, err)
+	}
+	symlinks, err := stringval(m, "symlinks")
+	if err == nil {
+		err = validSymlinks(symlinks)
+	}
+	if err != nil && !isKeyNotFound(err) {
+		return Rule{}, fmt.Errorf("%s: %s", pathVal, err)
+	}
+	dotfiles := true
+	dotfilesVal, err := boolval(m, "dotfiles")
+	if err == nil {
+		dotfiles = dotfilesVal
+	}
+
+	fullPath := path.Join(parentPath, pathVal)
+	var dir, file Attr
+	container := isContainer(m)
+	if !container {
+		dir, file, err = attrtupleval(m)
+		if err != nil {
+			return Rule{}, fmt.Errorf("%s: %s", fullPath, err)
+		}
+	}
+
+	r := Rule{
+		Path:      fullPath,
+		Recursive: recursive,
+		Dir:       dir,
+		File:      file,
+		Exclude:   exclude,
+		Symlinks:  symlinks,
+		Source:    src,
+		Container: container,
+
+		SkipDotfiles: !dotfiles,
+	}
+	if !recursive {
+		files, err := arrayval(m, "files")
+		if err == nil {
+			for n, i := range files {
+				fm, err := prepareFile(i)
+				if err != nil {
+					return Rule{}, err
+				}
+				childSrc := fmt.Sprintf("%s.files[%d]", src, n)
+				child, err := iterFile(fullPath, childSrc, fm)
+				if err != nil {
+					return Rule{}, err
+				}
+				r.Files = append(r.Files, child)
+			}
+		}
+	}
+	return r, nil
+}
+
+// isContainer reports whether an entry only groups nested files, without
+// attributes of its own.
+func isContainer(m map[string]interface{}) bool {
+	for _, key := range []string{"attr", "attr-dir", "attr-file"} {
+		if _, ok := m[key]; ok {
+			return false
+		}
+	}
+	_, ok := m["files"]
+	return ok
+}
+
+// decodeToml decodes a TOML document into the same generic values as the
+// JSON decoder. As TOML documents are always tables, a root table without
+// path is a list of entries in its files array.
+func decodeToml(d []byte) (interface{}, error) {
+	var m map[string]interface{}
+	err := toml.Unmarshal(d, &m)
+	if err != nil {
+		return nil, err
+	}
+	if len(m) == 0 {
+		return nil, nil
+	}
+
+	i := fromToml(m)
+	if _, ok := m["path"]; !ok {
+		return i.(map[string]interface{})["files"], nil
+	}
+	return i, nil
+}
+
+func fromToml(i interface{}) interface{} {
+	switch ii := i.(type) {
+	case map[string]interface{}:
+		r := make(map[string]interface{})
+		for k, v := range ii {
+			r[k] = fromToml(v)
+		}
+		return r
+	case []map[string]interface{}:
+		r := make([]interface{}, len(ii))
+		for n, v := range ii {
+			r[n] = fromToml(v)
+		}
+		return r
+	}
+	return i
+}
+
+func prepareFile(i interface{}) (map[string]interface{}, error) {
+	switch ii := i.(type) {
+	case map[string]interface{}:
+		return ii, nil
+	case map[interface{}]interface{}:
+		return fromYamlMap(ii)
+	}
+	return nil, fmt.Errorf("unsupported file type: %v", i)
+}
+
+func val(m map[string]interface{}, key string) (interface{}, error) {
+	i, ok := m[key]
+	if ok {
+		return i, nil
+	}
+
+	return "", keyNotFoundError(key)
+}
+
+type keyNotFoundError string
+
+func (e keyNotFoundError) Error() string {
+	return "Key not found: " + string(e)
+}
+
+func isKeyNotFound(err error) bool {
+	_, ok := err.(keyNotFoundError)
+	return ok
+}
+
+func stringval(m map[string]interface{}, key string) (string, error) {
+	i, err := val(m, key)
+	if err != nil {
+		return "", err
+	}
+	s, ok := i.(string)
+	if !ok {
+		return "", fmt.Errorf("Unable to cast to string: %s", key)
+	}
+
+	return s, nil
+}
+
+func boolval(m map[string]interface{}, key string) (bool, error) {
+	i, err := val(m, key)
+	if err != nil {
+		return false, err
+	}
+
+	bv, ok := i.(bool)
+	if !ok {
+		return false, fmt.Errorf("Unable to cast to bool: %s", key)
+	}
+	return bv, nil
+}
+
+func stringsval(m map[string]interface{}, key string) ([]string, error) {
+	a, err := arrayval(m, key)
+	if err != nil {
+		return nil, err
+	}
+	var ss []string
+	for _, i := range a {
+		s, ok := i.(string)
+		if !ok {
+			return nil, fmt.Errorf("Unable to cast to string: %s", key)
+		}
+		ss = append(ss, s)
+	}
+	return ss, nil
+}
+
+func attrval(m map[string]interface{}, key string) (Attr, error) {
+	v, err := stringval(m, key)
+	if err != nil {
+		return Attr{}, err
+	}
+
+	return ParseAttr(v)
+}
+
+func attrtupleval(m map[string]interface{}) (Attr, Attr, error) {
+	a, err := attrval(m, "attr")
+	if err == nil {
+		return a, a, nil
+	}
+	ad, err := attrval(m, "attr-dir")
+	if err != nil {
+		return Attr{}, Attr{}, err
+	}
+	af, err := attrval(m, "attr-file")
+	if err != nil {
+		return Attr{}, Attr{}, err
+	}
+	return ad, af, nil
+}
+
+func arrayval(m map[string]interface{}, key string) ([]interface{}, error) {
+	i, err := val(m, key)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := i.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Unable to cast to array: %s", key)
+	}
+	return v, nil
+}
+
+func fromYamlMap(m map[interface{}]interface{}) (map[string]interface{}, error) {
+	r := make(map[string]interface{})
+	for k, v := range m {
+		ky, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("key is not of string type: %v", k)
+		}
+		_, ok = r[ky]
+		if ok {
+			return nil, fmt.Errorf("key already exists: %s", ky)
+		}
+		r[ky] = v
+	}
+	return r, nil
+}
@@ -0,0 +1,215 @@
+package attrs
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"os"
+	"sort"
+	"sync"
+)
+
+// errStopped tells the walk to stop once a path failed, outside KeepGoing
+// mode.
+var errStopped = errors.New("stopped after a failure")
+
+// pool hands paths over to the applier on a fixed number of workers while
+// the walk goes on. A path is always applied by the same worker, so changes
+// to it keep their order, and failures are numbered in walk order so they
+// are reported the same way regardless of scheduling.
+type pool struct {
+	ctx       context.Context
+	ap        Applier
+	keepGoing bool
+	queues    []chan *job
+	wg        sync.WaitGroup
+
+	mu       sync.Mutex
+	seq      int
+	failures []seqFailure
+	stopped  bool
+	summary  Summary
+
+	// seqs maps paths to their job, for failures reported on flush
+	seqs map[string]int
+}
+
+// Summary counts the paths Apply went through.
+type Summary struct {
+	// Changed paths, or to be changed if the applier only reports them.
+	Changed int
+
+	// Unchanged paths already had the right attributes, the applier isn't
+	// called for them.
+	Unchanged int
+}
+
+type job struct {
+	seq  int
+	path string
+	info os.FileInfo
+	a    Attr
+	done chan struct{}
+}
+
+type seqFailure struct {
+	seq int
+	Failure
+}
+
+type bySeq []seqFailure
+
+func (s bySeq) Len() int           { return len(s) }
+func (s bySeq) Less(i, j int) bool { return s[i].seq < s[j].seq }
+func (s bySeq) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// newPool starts the workers, none if jobs is lower than two, as paths are
+// then applied right away.
+func newPool(ctx context.Context, ap Applier, jobs int, keepGoing bool) *pool {
+	p := &pool{ctx: ctx, ap: ap, keepGoing: keepGoing}
+	if _, ok := ap.(Flusher); ok {
+		p.seqs = make(map[string]int)
+	}
+	for i := 0; i < jobs && jobs > 1; i++ {
+		q := make(chan *job, 64)
+		p.queues = append(p.queues, q)
+		p.wg.Add(1)
+		go p.work(q)
+	}
+	return p
+}
+
+// apply queues a path, directories are waited for as the walk may list
+// them right after. It returns errStopped if the walk must stop.
+func (p *pool) apply(path string, info os.FileInfo, a Attr) error {
+	p.mu.Lock()
+	if p.stopped {
+		p.mu.Unlock()
+		return errStopped
+	}
+	p.seq++
+	j := &job{seq: p.seq, path: path, info: info, a: a}
+	p.mu.Unlock()
+
+	if len(p.queues) == 0 {
+		p.run(j)
+	} else {
+		if info.IsDir() {
+			j.done = make(chan struct{})
+		}
+		h := fnv.New32a()
+		h.Write([]byte(path))
+		p.queues[h.Sum32()%uint32(len(p.queues))] <- j
+		if j.done != nil {
+			<-j.done
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopped {
+		return errStopped
+	}
+	return nil
+}
+
+// fail records a failure found while walking, it returns errStopped unless
+// in KeepGoing mode.
+func (p *pool) fail(path string, err error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.seq++
+	p.record(p.seq, path, err)
+	if !p.keepGoing {
+		return errStopped
+	}
+	return nil
+}
+
+func (p *pool) record(seq int, path string, err error) {
+	p.failures = append(p.failures, seqFailure{seq, Failure{Path: path, Err: err}})
+	if !p.keepGoing {
+		p.stopped = true
+	}
+}
+
+func (p *pool) work(q chan *job) {
+	defer p.wg.Done()
+	for j := range q {
+		p.run(j)
+	}
+}
+
+func (p *pool) run(j *job) {
+	if j.done != nil {
+		defer close(j.done)
+	}
+	p.mu.Lock()
+	skip := p.stopped
+	p.mu.Unlock()
+	if skip || p.ctx.Err() != nil {
+		return
+	}
+
+	// leave ctime alone if there is nothing to change
+	changes, err := Diff(j.info, j.a)
+	if err == nil && len(changes) == 0 {
+		p.mu.Lock()
+		p.summary.Unchanged++
+		p.mu.Unlock()
+		return
+	}
+
+	err = p.ap.Apply(j.path, j.info, j.a)
+	p.mu.Lock()
+	if p.seqs != nil {
+		p.seqs[j.path] = j.seq
+	}
+	if err != nil {
+		p.record(j.seq, j.path, err)
+	} else {
+		p.summary.Changed++
+	}
+	p.mu.Unlock()
+}
+
+// wait stops the workers once every queued path is done and returns the
+// outcome of the whole walk, given the error it ended with: err itself if
+// it isn't a failure, else the earliest failure or, in KeepGoing mode,
+// every one of them.
+func (p *pool) wait(err error) error {
+	for _, q := range p.queues {
+		close(q)
+	}
+	p.wg.Wait()
+
+	ferr := flush(p.ap)
+	if failures, ok := ferr.(Failures); ok {
+		failed := make(map[string]bool)
+		for _, f := range failures {
+			p.record(p.seqs[f.Path], f.Path, f.Err)
+			if !failed[f.Path] {
+				failed[f.Path] = true
+				p.summary.Changed--
+			}
+		}
+	} else if ferr != nil && err == nil {
+		err = ferr
+	}
+
+	sort.Sort(bySeq(p.failures))
+	if err != nil && err != errStopped {
+		return err
+	}
+	if len(p.failures) == 0 {
+		return nil
+	}
+	if !p.keepGoing {
+		return p.failures[0].Err
+	}
+	failures := make(Failures, len(p.failures))
+	for i, f := range p.failures {
+		failures[i] = f.Failure
+	}
+	return failures
+}
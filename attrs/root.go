@@ -0,0 +1,146 @@
+package attrs
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// maximum number of symbolic links followed while resolving a path
+const maxSymlinks = 255
+
+// rootFS maps rule paths to host paths. With a root, rule paths are inside
+// it and symbolic links are resolved as if chrooted: absolute targets are
+// relative to the root and ".." never goes above it. Without a root, paths
+// are used as they are.
+type rootFS struct {
+	root string
+}
+
+// host returns the host path of p, resolving symbolic links in every
+// component but the last one, unless followLast is set.
+func (fs rootFS) host(p string, followLast bool) (string, error) {
+	if fs.root == "" {
+		if followLast {
+			return filepath.EvalSymlinks(p)
+		}
+		return p, nil
+	}
+
+	// resolved is relative to the root, "" being the root itself
+	resolved := ""
+	rest := strings.Split(p, "/")
+	links := 0
+	for len(rest) > 0 {
+		c := rest[0]
+		rest = rest[1:]
+		switch c {
+		case "", ".":
+			continue
+		case "..":
+			if i := strings.LastIndex(resolved, "/"); i >= 0 {
+				resolved = resolved[:i]
+			}
+			continue
+		}
+
+		next := resolved + "/" + c
+		if len(rest) == 0 && !followLast {
+			resolved = next
+			break
+		}
+		info, err := os.Lstat(fs.root + next)
+		if err != nil || !isSymlink(info) {
+			resolved = next
+			continue
+		}
+
+		links++
+		if links > maxSymlinks {
+			return "", fmt.Errorf("too many levels of symbolic links: %s", p)
+		}
+		target, err := os.Readlink(fs.root + next)
+		if err != nil {
+			return "", err
+		}
+		if path.IsAbs(target) {
+			resolved = ""
+		}
+		rest = append(strings.Split(target, "/"), rest...)
+	}
+	return filepath.Join(fs.root, resolved), nil
+}
+
+// logical maps a host path back to a rule path, like p: relative to the
+// root if any, else absolute or relative to the working directory.
+func (fs rootFS) logical(hp, p string) string {
+	if fs.root != "" {
+		rel, err := filepath.Rel(fs.root, hp)
+		if err != nil {
+			return hp
+		}
+		return path.Join("/", rel)
+	}
+	abs, err := filepath.Abs(hp)
+	if err != nil || filepath.IsAbs(p) {
+		return hp
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return hp
+	}
+	rel, err := filepath.Rel(wd, abs)
+	if err != nil {
+		return hp
+	}
+	return rel
+}
+
+func (fs rootFS) lstat(p string) (string, os.FileInfo, error) {
+	hp, err := fs.host(p, false)
+	if err != nil {
+		return "", nil, err
+	}
+	info, err := os.Lstat(hp)
+	return hp, info, err
+}
+
+func (fs rootFS) readDirNames(p string) ([]string, error) {
+	hp, err := fs.host(p, true)
+	if err != nil {
+		return nil, err
+	}
+	return readDirNames(hp)
+}
+
+// rooted returns a copy of the spec whose paths are absolute, relative ones
+// being relative to the root, refusing any ".." component.
+func (s *Spec) rooted() (*Spec, error) {
+	var root func(rs []Rule) ([]Rule, error)
+	root = func(rs []Rule) ([]Rule, error) {
+		var out []Rule
+		for _, r := range rs {
+			for _, c := range strings.Split(r.Path, "/") {
+				if c == ".." {
+					return nil, fmt.Errorf("%s (%s): path escapes root", r.Path, r.Source)
+				}
+			}
+			r.Path = path.Clean("/" + r.Path)
+			files, err := root(r.Files)
+			if err != nil {
+				return nil, err
+			}
+			r.Files = files
+			out = append(out, r)
+		}
+		return out, nil
+	}
+
+	rules, err := root(s.Rules)
+	if err != nil {
+		return nil, err
+	}
+	return &Spec{Rules: rules, Warnings: s.Warnings}, nil
+}
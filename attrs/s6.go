@@ -0,0 +1,95 @@
+package attrs
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// parseS6 reads the line based format of s6-overlay fix-attrs.d files:
+//
+//	path recurse account fmode dmode
+//
+// where account is user[:group][,uid[:gid]], the numeric ids being used if
+// the account is not found.
+func parseS6(d []byte, spec *Spec) error {
+	sc := bufio.NewScanner(bytes.NewReader(d))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		r, err := parseS6Line(line)
+		if err != nil {
+			return fmt.Errorf("line %d: %s", n, err)
+		}
+		r.Source = fmt.Sprintf("line %d", n)
+		spec.Rules = append(spec.Rules, r)
+	}
+	return sc.Err()
+}
+
+func parseS6Line(line string) (Rule, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 5 {
+		return Rule{}, fmt.Errorf("expected 5 fields, got %d", len(fields))
+	}
+
+	var recursive bool
+	switch fields[1] {
+	case "true":
+		recursive = true
+	case "false":
+		recursive = false
+	default:
+		return Rule{}, fmt.Errorf("invalid recurse value: %s", fields[1])
+	}
+
+	a, err := parseS6Account(fields[2])
+	if err != nil {
+		return Rule{}, err
+	}
+	for _, perm := range fields[3:] {
+		_, err := ParseMode(perm)
+		if err != nil {
+			return Rule{}, err
+		}
+	}
+	file, dir := a, a
+	file.Perm = fields[3]
+	dir.Perm = fields[4]
+
+	return Rule{
+		Path:      path.Clean(fields[0]),
+		Recursive: recursive,
+		Dir:       dir,
+		File:      file,
+	}, nil
+}
+
+func parseS6Account(s string) (Attr, error) {
+	var a Attr
+	account := s
+	if i := strings.Index(s, ","); i >= 0 {
+		account, a.fallback = s[:i], s[i+1:]
+		_, _, err := parseFallback(a.fallback)
+		if err != nil {
+			return Attr{}, err
+		}
+	}
+	if account == "" {
+		return Attr{}, fmt.Errorf("invalid account: %s", s)
+	}
+
+	parts := strings.SplitN(account, ":", 2)
+	a.Uid = parts[0]
+	if len(parts) == 2 {
+		a.Gid = parts[1]
+	} else {
+		a.loginGroup = true
+	}
+	return a, nil
+}
@@ -0,0 +1,63 @@
+package attrs
+
+import (
+	"fmt"
+	"os"
+)
+
+// symbolic link policies
+const (
+	// SymlinksSkip leaves symbolic links and their targets untouched.
+	SymlinksSkip = "skip"
+
+	// SymlinksLink changes the link itself, as lchown(2) does.
+	SymlinksLink = "link"
+
+	// SymlinksFollow changes the target of the link.
+	SymlinksFollow = "follow"
+)
+
+func validSymlinks(policy string) error {
+	switch policy {
+	case "", SymlinksSkip, SymlinksLink, SymlinksFollow:
+		return nil
+	}
+	return fmt.Errorf("invalid symlinks policy: %s", policy)
+}
+
+func isSymlink(info os.FileInfo) bool {
+	return info.Mode()&os.ModeSymlink != 0
+}
+
+// resolveSymlink applies the policy to a path stat'ed with Lstat, returning
+// the host path and info to operate on. A nil info means the path is
+// skipped.
+func (fs rootFS) resolveSymlink(p, hp string, info os.FileInfo, policy string) (string, os.FileInfo, error) {
+	if !isSymlink(info) {
+		return hp, info, nil
+	}
+
+	switch policy {
+	case SymlinksSkip:
+		return hp, nil, nil
+	case SymlinksLink:
+		return hp, info, nil
+	}
+
+	// loops are given up after too many links
+	target, err := fs.host(p, true)
+	if os.IsNotExist(err) {
+		return hp, nil, fmt.Errorf("dangling symbolic link: %s", hp)
+	}
+	if err != nil {
+		return hp, nil, fmt.Errorf("unable to follow symbolic link: %s", err)
+	}
+	tinfo, err := os.Lstat(target)
+	if os.IsNotExist(err) {
+		return hp, nil, fmt.Errorf("dangling symbolic link: %s", hp)
+	}
+	if err != nil {
+		return hp, nil, err
+	}
+	return target, tinfo, nil
+}
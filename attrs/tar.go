@@ -0,0 +1,143 @@
+package attrs
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// RewriteTar copies a tar stream, changing ownership and mode of the
+// entries matched by the spec, nothing is extracted. Paths are relative to
+// the root of the archive and names are resolved with opts.IDs. User and
+// group names of the headers come from opts.IDs, if set, or from the rules,
+// else they are cleared so they don't depend on the host. Symbolic
+// links can't be followed inside a stream, unless skipped only their
+// ownership is changed.
+func RewriteTar(ctx context.Context, r io.Reader, w io.Writer, spec *Spec, opts Options) error {
+	rt, err := newTarRewriter(spec, opts)
+	if err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(r)
+	tw := tar.NewWriter(w)
+	for {
+		err := ctx.Err()
+		if err != nil {
+			return err
+		}
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		rt.rewrite(hdr)
+		err = tw.WriteHeader(hdr)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(tw, tr)
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// tarRewriter changes tar headers according to a spec.
+type tarRewriter struct {
+	rules    []*Rule
+	ids      *IDs
+	names    bool
+	symlinks string
+}
+
+func newTarRewriter(spec *Spec, opts Options) (*tarRewriter, error) {
+	err := validSymlinks(opts.Symlinks)
+	if err != nil {
+		return nil, err
+	}
+	ids := opts.IDs
+	if ids == nil {
+		ids = hostIDs
+	}
+	err = spec.Resolve(ids)
+	if err != nil {
+		return nil, err
+	}
+	spec, err = spec.rooted()
+	if err != nil {
+		return nil, err
+	}
+	return &tarRewriter{rules: spec.rules(), ids: ids, names: opts.IDs != nil, symlinks: opts.Symlinks}, nil
+}
+
+// rewrite applies the attributes of the rule owning the entry, if any, and
+// reports whether the header changed.
+func (rt *tarRewriter) rewrite(hdr *tar.Header) bool {
+	p := path.Clean("/" + hdr.Name)
+	r := owner(rt.rules, p)
+	if r == nil {
+		return false
+	}
+
+	symlink := hdr.Typeflag == tar.TypeSymlink
+	policy := r.Symlinks
+	if policy == "" {
+		policy = rt.symlinks
+	}
+	if symlink && policy == SymlinksSkip {
+		return false
+	}
+
+	old := *hdr
+	a := r.attr(hdr.Typeflag == tar.TypeDir)
+	if a.uid != -1 {
+		hdr.Uid = a.uid
+		hdr.Uname = rt.name(a.Uid, a.uid, rt.ids.Uid, rt.ids.UserName)
+	}
+	if a.gid != -1 {
+		gid := a.Gid
+		if a.loginGroup {
+			gid = ""
+		}
+		hdr.Gid = a.gid
+		hdr.Gname = rt.name(gid, a.gid, rt.ids.Gid, rt.ids.GroupName)
+	}
+	if a.Perm != "" && !symlink {
+		m, err := ParseMode(a.Perm)
+		if err == nil {
+			cur := fileMode(uint32(hdr.Mode) & 07777)
+			perm := UnixPerm(m.Apply(cur, hdr.Typeflag == tar.TypeDir))
+			hdr.Mode = hdr.Mode&^07777 | int64(perm)
+		}
+	}
+	return hdr.Uid != old.Uid || hdr.Gid != old.Gid || hdr.Mode != old.Mode ||
+		hdr.Uname != old.Uname || hdr.Gname != old.Gname
+}
+
+// name returns the user or group name stored along an id: the one of the
+// names database given in the options, else the one of the rule if it
+// resolved to that id, else none, as host names could map back to other
+// ids when extracted.
+func (rt *tarRewriter) name(s string, id int, lookup func(string) (int, error), name func(int) string) string {
+	if rt.names {
+		return name(id)
+	}
+	if s == "" || strings.HasPrefix(s, "+") {
+		return ""
+	}
+	if _, err := strconv.Atoi(s); err == nil {
+		return ""
+	}
+	if n, err := lookup(s); err != nil || n != id {
+		return ""
+	}
+	return s
+}
@@ -0,0 +1,188 @@
+package attrs
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// parseTmpfiles reads systemd tmpfiles.d z (adjust) and Z (recursive
+// adjust) lines:
+//
+//	Type Path Mode User Group Age Argument
+//
+// where "-" or a missing field leaves that attribute unchanged. Any other
+// line type is reported as a warning and skipped.
+func parseTmpfiles(d []byte, spec *Spec) error {
+	sc := bufio.NewScanner(bytes.NewReader(d))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		r, err := parseTmpfilesLine(line)
+		if err != nil {
+			spec.Warnings = append(spec.Warnings, fmt.Sprintf("line %d: %s", n, err))
+			continue
+		}
+		r.Source = fmt.Sprintf("line %d", n)
+		spec.Rules = append(spec.Rules, r)
+	}
+	return sc.Err()
+}
+
+func parseTmpfilesLine(line string) (Rule, error) {
+	fields, err := splitTmpfilesLine(line)
+	if err != nil {
+		return Rule{}, err
+	}
+	if len(fields) < 2 {
+		return Rule{}, fmt.Errorf("missing path")
+	}
+
+	// boot only (!) and ignore errors (-) modifiers make no difference here
+	typ := strings.TrimRight(fields[0], "!-")
+	var recursive bool
+	switch typ {
+	case "z":
+		recursive = false
+	case "Z":
+		recursive = true
+	default:
+		return Rule{}, fmt.Errorf("unsupported line type: %s", fields[0])
+	}
+	for len(fields) < 5 {
+		fields = append(fields, "-")
+	}
+
+	mode := fields[2]
+	if strings.HasPrefix(mode, "~") || strings.HasPrefix(mode, ":") {
+		return Rule{}, fmt.Errorf("unsupported mode: %s", mode)
+	}
+	if mode != "-" {
+		// tmpfiles.d only takes octal modes
+		_, err := ParsePerm(mode)
+		if err != nil {
+			return Rule{}, err
+		}
+	}
+	if strings.Contains(fields[1], "%") {
+		return Rule{}, fmt.Errorf("unsupported specifier: %s", fields[1])
+	}
+
+	a := Attr{Uid: undash(fields[3]), Gid: undash(fields[4]), Perm: undash(mode)}
+	return Rule{
+		Path:      path.Clean(fields[1]),
+		Recursive: recursive,
+		Dir:       a,
+		File:      a,
+	}, nil
+}
+
+// splitTmpfilesLine splits on whitespace, honouring double quoted fields.
+func splitTmpfilesLine(line string) ([]string, error) {
+	var fields []string
+	for {
+		line = strings.TrimLeft(line, " \t")
+		if line == "" {
+			return fields, nil
+		}
+		if line[0] == '"' {
+			end := 1
+			for end < len(line) && line[end] != '"' {
+				if line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(line) {
+				return nil, fmt.Errorf("unterminated quote")
+			}
+			s, err := strconv.Unquote(line[:end+1])
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, s)
+			line = line[end+1:]
+			continue
+		}
+		end := strings.IndexAny(line, " \t")
+		if end < 0 {
+			end = len(line)
+		}
+		fields = append(fields, line[:end])
+		line = line[end:]
+	}
+}
+
+func undash(s string) string {
+	if s == "-" {
+		return ""
+	}
+	return s
+}
+
+// WriteTmpfiles writes the spec as tmpfiles.d z and Z lines. Rules with
+// different directory and file attributes, symbolic modes, excludes, ** or
+// {a,b} patterns or a symlinks policy can't be expressed and fail, as the
+// lines would cover more than the spec does.
+func WriteTmpfiles(w io.Writer, spec *Spec) error {
+	for _, r := range spec.rules() {
+		if r.container() {
+			continue
+		}
+		if r.Dir != r.File {
+			return fmt.Errorf("%s: different directory and file attributes are not supported by tmpfiles.d", r.Path)
+		}
+		if len(r.Exclude) > 0 {
+			return fmt.Errorf("%s: exclude is not supported by tmpfiles.d", r.Path)
+		}
+		if strings.Contains(r.Path, "**") || strings.Contains(r.Path, "{") {
+			return fmt.Errorf("%s: ** and {a,b} patterns are not supported by tmpfiles.d", r.Path)
+		}
+		if r.Symlinks != "" && r.Symlinks != SymlinksFollow {
+			return fmt.Errorf("%s: symlinks policy is not supported by tmpfiles.d", r.Path)
+		}
+		if r.File.Perm != "" {
+			if _, err := ParsePerm(r.File.Perm); err != nil {
+				return fmt.Errorf("%s: symbolic modes are not supported by tmpfiles.d", r.Path)
+			}
+		}
+
+		typ := "z"
+		if r.Recursive {
+			typ = "Z"
+		}
+		user, group, err := r.File.tmpfilesOwner()
+		if err != nil {
+			return fmt.Errorf("%s: %s", r.Path, err)
+		}
+		p := r.Path
+		if strings.ContainsAny(p, " \t\"") {
+			p = strconv.Quote(p)
+		}
+		_, err = fmt.Fprintf(w, "%s %s %s %s %s -\n", typ, p, dash(r.File.Perm), user, group)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tmpfilesOwner returns user and group fields, resolving numeric ids if
+// the attributes depend on lookups tmpfiles.d can't express.
+func (a Attr) tmpfilesOwner() (string, string, error) {
+	if a.loginGroup || a.fallback != "" {
+		uid, gid, err := a.ids()
+		if err != nil {
+			return "", "", err
+		}
+		return strconv.Itoa(uid), strconv.Itoa(gid), nil
+	}
+	return dash(a.Uid), dash(a.Gid), nil
+}
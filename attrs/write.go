@@ -0,0 +1,93 @@
+package attrs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// entry is a rule as written in a configuration file.
+type entry struct {
+	Path      string   `json:"path" yaml:"path" toml:"path"`
+	Recursive bool     `json:"recursive,omitempty" yaml:"recursive,omitempty" toml:"recursive,omitempty"`
+	Dotfiles  *bool    `json:"dotfiles,omitempty" yaml:"dotfiles,omitempty" toml:"dotfiles,omitempty"`
+	Exclude   []string `json:"exclude,omitempty" yaml:"exclude,omitempty" toml:"exclude,omitempty"`
+	Symlinks  string   `json:"symlinks,omitempty" yaml:"symlinks,omitempty" toml:"symlinks,omitempty"`
+	Attr      string   `json:"attr,omitempty" yaml:"attr,omitempty" toml:"attr,omitempty"`
+	AttrDir   string   `json:"attr-dir,omitempty" yaml:"attr-dir,omitempty" toml:"attr-dir,omitempty"`
+	AttrFile  string   `json:"attr-file,omitempty" yaml:"attr-file,omitempty" toml:"attr-file,omitempty"`
+	Files     []entry  `json:"files,omitempty" yaml:"files,omitempty" toml:"files,omitempty"`
+}
+
+// WriteConfig writes the spec as a JSON, YAML or TOML configuration,
+// nested rules as files relative to their parent.
+func WriteConfig(w io.Writer, spec *Spec, format string) error {
+	entries := toEntries(spec.Rules, "")
+	switch NormalizeFormat(format) {
+	case JSON:
+		d, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", d)
+		return err
+	case YAML:
+		d, err := yaml.Marshal(entries)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(d)
+		return err
+	case TOML:
+		return toml.NewEncoder(w).Encode(struct {
+			Files []entry `toml:"files"`
+		}{entries})
+	}
+	return fmt.Errorf("unsupported output format: %s", format)
+}
+
+func toEntries(rules []Rule, parent string) []entry {
+	entries := make([]entry, 0, len(rules))
+	for _, r := range rules {
+		e := entry{
+			Path:      relPath(parent, r.Path),
+			Recursive: r.Recursive,
+			Exclude:   r.Exclude,
+			Symlinks:  r.Symlinks,
+			Files:     toEntries(r.Files, r.Path),
+		}
+		if r.SkipDotfiles {
+			e.Dotfiles = new(bool)
+		}
+		switch {
+		case r.container():
+		case r.Dir == r.File:
+			e.Attr = r.Dir.String()
+		default:
+			e.AttrDir = r.Dir.String()
+			e.AttrFile = r.File.String()
+		}
+		if len(e.Files) == 0 {
+			e.Files = nil
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// relPath returns p relative to its parent rule path, as nested paths are
+// joined with it when parsed.
+func relPath(parent, p string) string {
+	if parent == "" {
+		return p
+	}
+	rel, err := filepath.Rel(parent, p)
+	if err != nil {
+		return p
+	}
+	return rel
+}
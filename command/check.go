@@ -0,0 +1,58 @@
+package command
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/codegangsta/cli"
+	"github.com/glerchundi/fix-attrs/attrs"
+)
+
+// exit status used when attributes differ from the configuration
+const exitDrift = 2
+
+func NewCheckCommand() cli.Command {
+	return cli.Command{
+		Name:  "check",
+		Usage: "checks attributes without modifying them, exits with status 2 on drift or missing paths",
+		Flags: []cli.Flag{
+			formatFlag,
+			strictFlag,
+			symlinksFlag,
+			rootFlag,
+		},
+		Action: handleCheck,
+	}
+}
+
+func handleCheck(c *cli.Context) {
+	// params
+	format := c.String("format")
+	strict := c.Bool("strict")
+	symlinks := c.String("symlinks")
+	root := c.String("root")
+	cfgPath := c.Args().First()
+
+	// print every mismatch, never mutate
+	ap := &planApplier{w: os.Stdout}
+	spec := loadSpec(cfgPath, format, strict)
+	opts := attrs.Options{
+		Applier:   ap,
+		KeepGoing: true,
+		Symlinks:  symlinks,
+		Root:      root,
+	}
+	err := attrs.Apply(context.Background(), spec, opts)
+	failures, ok := err.(attrs.Failures)
+	if err != nil && !ok {
+		log.Fatal(err.Error())
+	}
+	// missing or unreadable paths don't match the configuration either
+	if len(failures) > 0 {
+		printFailures(os.Stderr, failures)
+	}
+	if ap.changed > 0 || len(failures) > 0 {
+		os.Exit(exitDrift)
+	}
+}
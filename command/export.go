@@ -0,0 +1,66 @@
+package command
+
+import (
+	"bufio"
+	"log"
+	"os"
+
+	"github.com/codegangsta/cli"
+	"github.com/glerchundi/fix-attrs/attrs"
+)
+
+func NewExportCommand() cli.Command {
+	return cli.Command{
+		Name:  "export",
+		Usage: "prints a configuration reproducing the attributes of a directory tree",
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "format",
+				Value: attrs.JSON,
+				Usage: "output format (json, yaml, toml), defaults to json",
+			},
+			cli.StringFlag{
+				Name:  "path",
+				Value: "",
+				Usage: "path of the tree in the configuration, defaults to the directory itself",
+			},
+			cli.BoolFlag{
+				Name:  "names",
+				Usage: "use user and group names instead of numeric ids",
+			},
+			namesRootFlag,
+		},
+		Action: handleExport,
+	}
+}
+
+func handleExport(c *cli.Context) {
+	// params
+	format := c.String("format")
+	root := c.String("root")
+	dir := c.Args().First()
+	if dir == "" {
+		log.Fatal("please provide a directory")
+	}
+
+	opts := attrs.ExportOptions{
+		Path:  c.String("path"),
+		Names: c.Bool("names"),
+	}
+	if root != "" {
+		opts.IDs = attrs.NewIDs(root)
+	}
+
+	spec, err := attrs.Export(dir, opts)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	w := bufio.NewWriter(os.Stdout)
+	err = attrs.WriteConfig(w, spec, format)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+}
@@ -1,69 +1,74 @@
 package command
 
 import (
+	"context"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"log"
 	"os"
-	"os/exec"
-	"path"
-	"path/filepath"
+	"os/signal"
 	"strings"
-
-	json "encoding/json"
-	yaml "gopkg.in/yaml.v2"
+	"syscall"
+	"text/tabwriter"
 
 	"github.com/codegangsta/cli"
+	"github.com/glerchundi/fix-attrs/attrs"
 )
 
 const (
-	JSON = "json"
-	YAML = "yml"
+	NATIVE = "native"
+	EXEC   = "exec"
 )
 
-type idOrError struct {
-	id  int
-	err error
-}
-
-var uidmap map[string]idOrError
-var gidmap map[string]idOrError
-
-type key string
-type value struct {
-	recursive bool
-	attrs     attrtuple
-}
-
-type attr struct {
-	uid, gid string
-	perm     string
-}
-
-type attrtuple struct {
-	dirAttr  attr
-	fileAttr attr
-}
-
 func NewFixCommand() cli.Command {
 	return cli.Command{
 		Name:  "fix",
 		Usage: "fixes attributes",
 		Flags: []cli.Flag{
+			formatFlag,
+			cli.StringFlag{
+				Name:  "backend",
+				Value: NATIVE,
+				Usage: "backend used to apply attributes (native, exec), defaults to native",
+			},
+			cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "print attribute changes without applying them",
+			},
+			strictFlag,
+			symlinksFlag,
+			rootFlag,
+			cli.BoolFlag{
+				Name:  "keep-going",
+				Usage: "continue on per path errors and report them at the end",
+			},
+			cli.IntFlag{
+				Name:  "jobs",
+				Value: 1,
+				Usage: "number of paths applied concurrently, ignored by dry-run",
+			},
+			cli.BoolFlag{
+				Name:  "atomic",
+				Usage: "restore every changed path on the first error or interrupt",
+			},
 			cli.StringFlag{
-				Name:  "format",
+				Name:  "journal",
 				Value: "",
-				Usage: "file format (json, yaml), defaults to json",
+				Usage: "append previous attributes of every changed path to this file, see rollback",
 			},
 			cli.StringFlag{
 				Name:  "chown-bin",
 				Value: "chown",
-				Usage: "chown binary",
+				Usage: "chown binary, used by exec backend",
 			},
 			cli.StringFlag{
 				Name:  "chmod-bin",
 				Value: "chmod",
-				Usage: "chmod binary",
+				Usage: "chmod binary, used by exec backend",
+			},
+			cli.BoolFlag{
+				Name:  "batch",
+				Usage: "group paths sharing attributes into single chown and chmod invocations run after the walk, used by exec backend",
 			},
 		},
 		Action: handleFix,
@@ -71,312 +76,188 @@ func NewFixCommand() cli.Command {
 }
 
 func handleFix(c *cli.Context) {
-	// error
-	var err error
-
 	// params
 	format := c.String("format")
+	backend := c.String("backend")
+	dryRun := c.Bool("dry-run")
+	keepGoing := c.Bool("keep-going")
+	atomic := c.Bool("atomic")
+	jobs := c.Int("jobs")
+	strict := c.Bool("strict")
+	symlinks := c.String("symlinks")
+	root := c.String("root")
+	journal := c.String("journal")
 	chownBin := c.String("chown-bin")
 	chmodBin := c.String("chmod-bin")
+	batch := c.Bool("batch")
 	cfgPath := c.Args().First()
 
-	// chown binary path
-	chownPath, err := exec.LookPath(chownBin)
-	if err != nil {
-		log.Fatal("please provide a valid chown binary path")
-	}
-
-	// chmod binary path
-	chmodPath, err := exec.LookPath(chmodBin)
-	if err != nil {
-		log.Fatal("please provide a valid chmod binary path")
-	}
-
-	// cfg file
-	if !fileExists(cfgPath) {
-		log.Fatal("please provide a configuration file")
-	}
-
-	// format
-	if format == "" {
-		format = filepath.Ext(cfgPath)
-		if format != "" {
-			format = format[1:]
+	// backend
+	var ap attrs.Applier
+	switch strings.ToLower(backend) {
+	case NATIVE:
+		ap = &attrs.NativeApplier{}
+	case EXEC:
+		var err error
+		if batch {
+			ap, err = attrs.NewBatchExecApplier(chownBin, chmodBin)
 		} else {
-			format = JSON
+			ap, err = attrs.NewExecApplier(chownBin, chmodBin)
 		}
-	}
-	format = strings.ToLower(format)
-
-	// loop parameters
-	var m map[string]value
-
-	// uid/gid cache
-	uidmap = make(map[string]idOrError)
-	gidmap = make(map[string]idOrError)
-
-	// start fixin!
-	m = parseFile(cfgPath, format)
-	for k, v := range m {
-		if !v.recursive {
-			var files []string
-			if strings.Contains(k, "*") {
-				files, err = filepath.Glob(k)
-				if err != nil {
-					log.Fatal(err.Error())
-				}
-			} else {
-				files = append(files, k)
-			}
-			for _, f := range files {
-				info, err := os.Stat(f)
-				if err != nil {
-					log.Fatal(fmt.Sprintf("no such file or directory: %s", k))
-				}
-				err = changeOwnershipAndMode(chownPath, chmodPath, f, info, v)
-				if err != nil {
-					log.Fatal(err.Error())
-				}
-			}
-		} else {
-			walk := func(path string, info os.FileInfo, err error) error {
-				if err != nil {
-					return err
-				}
-				err = changeOwnershipAndMode(chownPath, chmodPath, path, info, v)
-				if err != nil {
-					return err
-				}
-				return nil
-			}
-			err = filepath.Walk(k, walk)
-			if err != nil {
-				log.Fatal(err.Error())
-			}
+		if err != nil {
+			log.Fatal("please provide valid chown and chmod binary paths")
+		}
+	default:
+		log.Fatal("please provide a valid backend")
+	}
+	if dryRun {
+		// changes are printed in walk order
+		ap = &planApplier{w: os.Stdout}
+		jobs = 1
+	} else if journal != "" {
+		f, err := os.OpenFile(journal, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			log.Fatal(err.Error())
 		}
+		defer f.Close()
+		ap = attrs.NewJournal(f, ap)
 	}
-}
 
-func execCommand(binPath string, args ...string) error {
-	cmd := exec.Command(binPath, args...)
-	err := cmd.Start()
-	if err != nil {
-		return err
+	// start fixin!
+	spec := loadSpec(cfgPath, format, strict)
+	opts := attrs.Options{
+		Applier:   ap,
+		KeepGoing: keepGoing,
+		Symlinks:  symlinks,
+		Root:      root,
+		Jobs:      jobs,
+		Atomic:    atomic,
+	}
+	var summary attrs.Summary
+	opts.Summary = &summary
+	ctx := context.Background()
+	if atomic {
+		// interrupting restores what was changed so far
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-sigs
+			cancel()
+		}()
+	}
+	err := attrs.Apply(ctx, spec, opts)
+	if err == context.Canceled {
+		log.Fatal("interrupted, previous attributes restored")
+	}
+	if failures, ok := err.(attrs.Failures); ok && keepGoing {
+		printFailures(os.Stderr, failures)
+		printSummary(os.Stderr, summary, dryRun)
+		os.Exit(1)
 	}
-	err = cmd.Wait()
 	if err != nil {
-		return err
+		log.Fatal(err.Error())
 	}
-	return nil
+	printSummary(os.Stderr, summary, dryRun)
 }
 
-func changeOwnershipAndMode(chownPath, chmodPath string,
-	path string, info os.FileInfo, v value) error {
-	var err error
-	var attr attr
-
-	if info.IsDir() {
-		attr = v.attrs.dirAttr
-	} else {
-		attr = v.attrs.fileAttr
+// printSummary writes how many paths were changed and how many already had
+// the right attributes.
+func printSummary(w io.Writer, s attrs.Summary, dryRun bool) {
+	verb := "changed"
+	if dryRun {
+		verb = "to change"
 	}
-	err = execCommand(chownPath, attr.uid+":"+attr.gid, path)
-	if err != nil {
-		return err
-	}
-	err = execCommand(chmodPath, attr.perm, path)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	fmt.Fprintf(w, "%d path(s) %s, %d already correct\n", s.Changed, verb, s.Unchanged)
 }
 
-func parseFile(f string, format string) map[string]value {
-	d, err := ioutil.ReadFile(f)
-	if err != nil {
-		log.Fatal("unable to open file: ", f)
+// printFailures writes a summary table with every failed path.
+func printFailures(w io.Writer, failures attrs.Failures) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "PATH\tERROR")
+	for _, f := range failures {
+		fmt.Fprintf(tw, "%s\t%s\n", f.Path, f.Err)
 	}
-	return parseContent(d, format)
+	tw.Flush()
+	fmt.Fprintf(w, "%d path(s) failed\n", len(failures))
 }
 
-func parseContent(d []byte, format string) map[string]value {
-	var i interface{}
-	switch format {
-	case JSON:
-		json.Unmarshal([]byte(d), &i)
-	case YAML:
-		yaml.Unmarshal([]byte(d), &i)
-	default:
-		log.Fatal("please provide a valid format")
-	}
-
-	if i == nil {
-		log.Fatal("unable to parse, no content or invalid format provided.")
-	}
-
-	fm := make(map[string]value)
-	iterRoot(i, fm)
-	return fm
+var formatFlag = cli.StringFlag{
+	Name:  "format",
+	Value: "",
+	Usage: "file format (json, yaml, toml, s6, tmpfiles), defaults to json or s6 for directories",
 }
 
-func iterRoot(m interface{}, fm map[string]value) {
-	switch mm := m.(type) {
-	case []interface{}:
-	for _, v := range mm {
-		iterRoot(v, fm)
-	}
-	case map[string]interface{}, map[interface{}]interface{}:
-		iterFile("", prepareFile(mm), fm)
-	default:
-		fmt.Println(mm)
-	}
+var strictFlag = cli.BoolFlag{
+	Name:  "strict",
+	Usage: "reject configurations with duplicate or overlapping paths",
 }
 
-func iterFile(parentPath string, m map[string]interface{}, fm map[string]value) {
-	pathVal, err := stringval(m, "path")
-	if err != nil {
-		log.Fatal(err.Error())
-	}
-	recursive := false
-	recursiveVal, err := boolval(m, "recursive")
-	if err == nil {
-		recursive = recursiveVal
-	}
-
-	/*
-		TODO: duplicate file/path's?
-		_, ok := fm[fullPath]; if ok {
-			log.Fatal("duplicate path: ", fullPath)
-		}
-	*/
-	fullPath := path.Join(parentPath, pathVal)
-	t, err := attrtupleval(m)
-	if err != nil {
-		log.Fatal(err.Error())
-	}
-
-	fm[fullPath] = value{recursive: recursive, attrs: t}
-	if !recursive {
-		files, err := arrayval(m, "files")
-		if err == nil {
-			for _, i := range files {
-				iterFile(fullPath, prepareFile(i), fm)
-			}
-		}
-	}
+var rootFlag = cli.StringFlag{
+	Name:  "root",
+	Value: "",
+	Usage: "apply paths inside this directory, resolving names from its etc/passwd and etc/group",
 }
 
-func prepareFile(i interface{}) map[string]interface{} {
-	switch ii := i.(type) {
-	case map[string]interface{}:
-		return ii
-	case map[interface{}]interface{}:
-		return fromYamlMap(ii)
-	default:
-		fmt.Println("unsupported file type")
-	}
-	return nil
+var namesRootFlag = cli.StringFlag{
+	Name:  "root",
+	Value: "",
+	Usage: "resolve names from this directory's etc/passwd and etc/group instead of the host ones",
 }
 
-func val(m map[string]interface{}, key string) (interface{}, error) {
-	i, ok := m[key]
-	if ok {
-		return i, nil
-	}
-
-	return "", fmt.Errorf("Key not found: %s", key)
+var symlinksFlag = cli.StringFlag{
+	Name:  "symlinks",
+	Value: attrs.SymlinksFollow,
+	Usage: "symbolic links policy for entries without their own (skip, link, follow)",
 }
 
-func stringval(m map[string]interface{}, key string) (string, error) {
-	i, err := val(m, key)
-	if err != nil {
-		return "", err
-	}
-	s, ok := i.(string)
-	if !ok {
-		return "", fmt.Errorf("Unable to cast to string: %s", key)
-	}
-
-	return s, nil
-}
-
-func boolval(m map[string]interface{}, key string) (bool, error) {
-	i, err := val(m, key)
+// loadSpec detects configuration format, if not provided, and parses it.
+// Duplicate or overlapping rules are reported and, in strict mode, rejected.
+func loadSpec(cfgPath, format string, strict bool) *attrs.Spec {
+	// cfg file
+	info, err := os.Stat(cfgPath)
 	if err != nil {
-		return false, err
+		log.Fatal("please provide a configuration file")
 	}
 
-	bv, ok := i.(bool)
-	if !ok {
-		return false, fmt.Errorf("Unable to cast to bool: %s", key)
+	var spec *attrs.Spec
+	if info.IsDir() {
+		// a directory of s6 fix-attrs.d like files
+		if format == "" {
+			format = attrs.S6
+		}
+		spec, err = attrs.ParseDir(cfgPath, format)
+	} else {
+		// format
+		if format == "" {
+			format = attrs.DetectFormat(cfgPath)
+		}
+		spec, err = parseFile(cfgPath, format)
 	}
-	return bv, nil
-}
-
-func attrval(m map[string]interface{}, key string) (attr, error) {
-	v, err := stringval(m, key)
 	if err != nil {
-		return attr{}, err
+		log.Fatal(err.Error())
 	}
 
-	parts := strings.Split(v, ":")
-	if len(parts) != 3 {
-		return attr{}, fmt.Errorf("Unable to parse attributes: %s", key)
+	for _, w := range spec.Warnings {
+		log.Printf("%s: %s", cfgPath, w)
 	}
-
-	uid  := parts[0]
-	gid  := parts[1]
-	perm := parts[2]
-
-	return attr{uid: uid, gid: gid, perm: perm}, nil
-}
-
-func attrtupleval(m map[string]interface{}) (attrtuple, error) {
-	a, err := attrval(m, "attr")
-	if err == nil {
-		return attrtuple{dirAttr: a, fileAttr: a}, nil
-	}
-	ad, err := attrval(m, "attr-dir")
-	if err != nil {
-		return attrtuple{}, err
+	conflicts := spec.Conflicts()
+	for _, c := range conflicts {
+		log.Printf("%s: %s", cfgPath, c)
 	}
-	af, err := attrval(m, "attr-file")
-	if err != nil {
-		return attrtuple{}, err
+	if strict && len(conflicts) > 0 {
+		log.Fatal("conflicting paths found, rejecting configuration")
 	}
-	return attrtuple{dirAttr: ad, fileAttr: af}, nil
+	return spec
 }
 
-func arrayval(m map[string]interface{}, key string) ([]interface{}, error) {
-	i, err := val(m, key)
+func parseFile(cfgPath, format string) (*attrs.Spec, error) {
+	f, err := os.Open(cfgPath)
 	if err != nil {
 		return nil, err
 	}
-	v, ok := i.([]interface{})
-	if !ok {
-		return nil, fmt.Errorf("Unable to cast to array: %s", key)
-	}
-	return v, nil
-}
-
-func fromYamlMap(m map[interface{}]interface{}) map[string]interface{} {
-	r := make(map[string]interface{})
-	for k, v := range m {
-		ky, ok := k.(string)
-		if !ok {
-			fmt.Println("key is not of string type")
-		}
-		_, ok = r[ky]
-		if ok {
-			fmt.Println("key already exists")
-		}
-		r[ky] = v
-	}
-	return r
-}
-
-func fileExists(filePath string) bool {
-	_, err := os.Stat(filePath)
-	return err == nil
+	defer f.Close()
+	return attrs.Parse(f, format)
 }
@@ -0,0 +1,62 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/codegangsta/cli"
+	"github.com/glerchundi/fix-attrs/attrs"
+)
+
+func NewOCICommand() cli.Command {
+	return cli.Command{
+		Name:  "oci",
+		Usage: "fixes attributes of an OCI image layout by adding a new layer",
+		Flags: []cli.Flag{
+			formatFlag,
+			strictFlag,
+			symlinksFlag,
+			namesRootFlag,
+			cli.StringFlag{
+				Name:  "ref",
+				Value: "",
+				Usage: "manifest to fix, by its org.opencontainers.image.ref.name annotation",
+			},
+			cli.BoolFlag{
+				Name:  "rewrite-top",
+				Usage: "replace the top layer instead of appending a new one",
+			},
+		},
+		Action: handleOCI,
+	}
+}
+
+func handleOCI(c *cli.Context) {
+	// params
+	format := c.String("format")
+	strict := c.Bool("strict")
+	symlinks := c.String("symlinks")
+	root := c.String("root")
+	cfgPath := c.Args().Get(0)
+	layoutPath := c.Args().Get(1)
+	if layoutPath == "" {
+		log.Fatal("please provide an OCI image layout directory")
+	}
+
+	opts := attrs.LayoutOptions{
+		Options:    attrs.Options{Symlinks: symlinks},
+		Ref:        c.String("ref"),
+		RewriteTop: c.Bool("rewrite-top"),
+	}
+	if root != "" {
+		opts.IDs = attrs.NewIDs(root)
+	}
+
+	spec := loadSpec(cfgPath, format, strict)
+	n, err := attrs.FixLayout(context.Background(), layoutPath, spec, opts)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	fmt.Printf("%d entries changed\n", n)
+}
@@ -0,0 +1,31 @@
+package command
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/glerchundi/fix-attrs/attrs"
+)
+
+// planApplier prints what would change instead of applying it, keeping
+// count of how many paths differ.
+type planApplier struct {
+	w       io.Writer
+	changed int
+}
+
+func (p *planApplier) Apply(path string, info os.FileInfo, a attrs.Attr) error {
+	changes, err := attrs.Diff(info, a)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	p.changed++
+	fmt.Fprintf(p.w, "%s: %s\n", path, strings.Join(changes, ", "))
+	return nil
+}
@@ -0,0 +1,54 @@
+package command
+
+import (
+	"context"
+	"log"
+	"os"
+
+	"github.com/codegangsta/cli"
+	"github.com/glerchundi/fix-attrs/attrs"
+)
+
+func NewRollbackCommand() cli.Command {
+	return cli.Command{
+		Name:  "rollback",
+		Usage: "restores the attributes recorded in a journal by fix --journal",
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "print attribute changes without applying them",
+			},
+			cli.BoolFlag{
+				Name:  "keep-going",
+				Usage: "continue on per path errors and report them at the end",
+			},
+		},
+		Action: handleRollback,
+	}
+}
+
+func handleRollback(c *cli.Context) {
+	// params
+	dryRun := c.Bool("dry-run")
+	keepGoing := c.Bool("keep-going")
+	journal := c.Args().First()
+
+	f, err := os.Open(journal)
+	if err != nil {
+		log.Fatal("please provide a journal file")
+	}
+	defer f.Close()
+
+	opts := attrs.Options{KeepGoing: keepGoing}
+	if dryRun {
+		opts.Applier = &planApplier{w: os.Stdout}
+	}
+	err = attrs.Rollback(context.Background(), f, opts)
+	if failures, ok := err.(attrs.Failures); ok && keepGoing {
+		printFailures(os.Stderr, failures)
+		os.Exit(1)
+	}
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+}
@@ -0,0 +1,49 @@
+package command
+
+import (
+	"bufio"
+	"context"
+	"log"
+	"os"
+
+	"github.com/codegangsta/cli"
+	"github.com/glerchundi/fix-attrs/attrs"
+)
+
+func NewTarCommand() cli.Command {
+	return cli.Command{
+		Name:  "tar",
+		Usage: "fixes attributes of a tar archive read from stdin, writing it to stdout",
+		Flags: []cli.Flag{
+			formatFlag,
+			strictFlag,
+			symlinksFlag,
+			namesRootFlag,
+		},
+		Action: handleTar,
+	}
+}
+
+func handleTar(c *cli.Context) {
+	// params
+	format := c.String("format")
+	strict := c.Bool("strict")
+	symlinks := c.String("symlinks")
+	root := c.String("root")
+	cfgPath := c.Args().First()
+
+	opts := attrs.Options{Symlinks: symlinks}
+	if root != "" {
+		opts.IDs = attrs.NewIDs(root)
+	}
+
+	spec := loadSpec(cfgPath, format, strict)
+	w := bufio.NewWriter(os.Stdout)
+	err := attrs.RewriteTar(context.Background(), bufio.NewReader(os.Stdin), w, spec, opts)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+}
@@ -0,0 +1,32 @@
+package command
+
+import (
+	"log"
+	"os"
+
+	"github.com/codegangsta/cli"
+	"github.com/glerchundi/fix-attrs/attrs"
+)
+
+func NewTmpfilesCommand() cli.Command {
+	return cli.Command{
+		Name:  "tmpfiles",
+		Usage: "prints configuration as systemd tmpfiles.d z/Z lines",
+		Flags: []cli.Flag{
+			formatFlag,
+		},
+		Action: handleTmpfiles,
+	}
+}
+
+func handleTmpfiles(c *cli.Context) {
+	// params
+	format := c.String("format")
+	cfgPath := c.Args().First()
+
+	spec := loadSpec(cfgPath, format, false)
+	err := attrs.WriteTmpfiles(os.Stdout, spec)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+}
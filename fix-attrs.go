@@ -13,6 +13,12 @@ func main() {
 	app.Usage = "fixes files attributes based on configuration file"
 	app.Commands = []cli.Command{
 		command.NewFixCommand(),
+		command.NewCheckCommand(),
+		command.NewTmpfilesCommand(),
+		command.NewTarCommand(),
+		command.NewOCICommand(),
+		command.NewExportCommand(),
+		command.NewRollbackCommand(),
 	}
 	app.Run(os.Args)
 }